@@ -0,0 +1,262 @@
+package eureka
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/st3v/go-eureka/retry"
+)
+
+var (
+	// DefaultBalancerSelector defines the default selector used by balancers
+	// to pick instances. No instance is tried twice before all instances have
+	// been tried.
+	DefaultBalancerSelector retry.Selector = retry.Shuffle(nil)
+
+	// DefaultBalancerRetryLimit defines the default allowance for attempts of
+	// idempotent requests. Attempts are further limited to the number of
+	// instances that are up.
+	DefaultBalancerRetryLimit retry.Allow = retry.MaxRetries(3)
+)
+
+// ErrNoInstances is returned by a Balancer if none of the instances of the
+// requested app are up.
+var ErrNoInstances = errors.New("No instances available")
+
+// Balancer is an http.RoundTripper that treats the host of a request URL as
+// the name of an app, e.g. http://ORDERS/api/orders, and sends the request to
+// one of the instances of that app that are up instead. The instances are
+// cached from a watcher. Idempotent requests are retried on another instance
+// if the connection to an instance fails.
+type Balancer struct {
+	watcher      *Watcher
+	batches      *Subscription
+	watchOptions []WatchOption
+	base         http.RoundTripper
+	selector     retry.Selector
+	limit        retry.Allow
+
+	mtx       sync.RWMutex
+	instances map[string][]*Instance
+
+	synced chan struct{}
+	done   chan struct{}
+}
+
+// BalancerOption configures a Balancer.
+type BalancerOption func(*Balancer)
+
+// BalancerBase defines the round tripper used to send requests to instances,
+// http.DefaultTransport by default.
+func BalancerBase(base http.RoundTripper) BalancerOption {
+	return func(b *Balancer) {
+		b.base = base
+	}
+}
+
+// BalancerSelector defines how instances are picked for each request.
+func BalancerSelector(selector retry.Selector) BalancerOption {
+	return func(b *Balancer) {
+		b.selector = selector
+	}
+}
+
+// BalancerRetryLimit defines the allowance for attempts of idempotent
+// requests. Other requests are never retried.
+func BalancerRetryLimit(limit retry.Allow) BalancerOption {
+	return func(b *Balancer) {
+		b.limit = limit
+	}
+}
+
+// BalancerWatchOptions passes the given options to the underlying watcher,
+// e.g. to restrict the apps that can be requested.
+func BalancerWatchOptions(options ...WatchOption) BalancerOption {
+	return func(b *Balancer) {
+		b.watchOptions = append(b.watchOptions, options...)
+	}
+}
+
+// NewBalancer returns a balancer that watches the given registry at the
+// defined interval. Call Stop to stop watching.
+func NewBalancer(registry Registry, pollInterval time.Duration, options ...BalancerOption) *Balancer {
+	b := &Balancer{
+		base:      http.DefaultTransport,
+		selector:  DefaultBalancerSelector,
+		limit:     DefaultBalancerRetryLimit,
+		instances: make(map[string][]*Instance),
+		synced:    make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	for _, opt := range options {
+		opt(b)
+	}
+
+	b.watcher = NewWatcher(registry, pollInterval, b.watchOptions...)
+	b.batches = b.watcher.SubscribeBatches(0)
+
+	go b.run()
+
+	return b
+}
+
+// Stop stops watching the registry.
+func (b *Balancer) Stop() {
+	b.watcher.Stop()
+	<-b.done
+}
+
+// run refreshes the cached instances once the watcher has synced and again
+// whenever the watcher observes changes.
+func (b *Balancer) run() {
+	defer close(b.done)
+
+	if err := b.watcher.WaitForSync(b.watcher.ctx); err != nil {
+		return
+	}
+
+	b.refresh()
+	close(b.synced)
+
+	for range b.batches.Batches() {
+		b.refresh()
+	}
+}
+
+func (b *Balancer) refresh() {
+	instances := make(map[string][]*Instance)
+
+	for app, all := range b.watcher.Snapshot() {
+		app = strings.ToUpper(app)
+		for _, i := range all {
+			if i.Status == StatusUp {
+				instances[app] = append(instances[app], i)
+			}
+		}
+	}
+
+	b.mtx.Lock()
+	b.instances = instances
+	b.mtx.Unlock()
+}
+
+// Instances returns the cached instances of the given app that are up.
+func (b *Balancer) Instances(app string) []*Instance {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	return append([]*Instance(nil), b.instances[strings.ToUpper(app)]...)
+}
+
+// RoundTrip sends the request to an instance of the app named by its host.
+// The scheme of the request is kept, https requests are sent to the secure
+// port of an instance. RoundTrip waits for the watcher to sync first.
+func (b *Balancer) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	select {
+	case <-b.synced:
+	case <-b.done:
+		return nil, errors.New("Balancer has been stopped")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	app := req.URL.Hostname()
+	secure := req.URL.Scheme == "https"
+
+	var (
+		endpoints []string
+		seen      = make(map[string]bool)
+	)
+
+	for _, i := range b.Instances(app) {
+		addr := i.Address(secure)
+		if !seen[addr] {
+			seen[addr] = true
+			endpoints = append(endpoints, addr)
+		}
+	}
+
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("%s: %w", app, ErrNoInstances)
+	}
+
+	retries := idempotent(req)
+	allow := func(state retry.State) bool {
+		if state.Attempt == 0 {
+			return true
+		}
+
+		return retries && ctx.Err() == nil &&
+			state.Attempt < uint(len(endpoints)) &&
+			b.limit(state.Attempt)
+	}
+
+	var (
+		resp    *http.Response
+		attempt int
+	)
+
+	err := retry.NewStatefulStrategy(
+		b.selector(endpoints),
+		allow,
+		retry.NoDelay().Stateful(),
+	).Apply(func(endpoint string) error {
+		out, err := rewrite(req, endpoint, attempt > 0)
+		attempt++
+		if err != nil {
+			return err
+		}
+
+		resp, err = b.base.RoundTrip(out)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// rewrite returns a copy of the request sent to the given address. The body
+// is rewound if the request is being retried.
+func rewrite(req *http.Request, addr string, retried bool) (*http.Request, error) {
+	out := req.Clone(req.Context())
+	out.URL.Host = addr
+	out.Host = ""
+
+	if retried && req.Body != nil && req.Body != http.NoBody {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		out.Body = body
+	}
+
+	return out, nil
+}
+
+// idempotent checks if a request can be retried safely, i.e. if it uses an
+// idempotent method or carries an idempotency key, and if its body can be
+// sent again.
+func idempotent(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	_, key := req.Header["Idempotency-Key"]
+	_, xkey := req.Header["X-Idempotency-Key"]
+	return key || xkey
+}
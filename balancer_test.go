@@ -0,0 +1,183 @@
+package eureka
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/st3v/go-eureka/retry"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Balancer", func() {
+	var (
+		interval = 10 * time.Millisecond
+
+		registry *mockRegistry
+		balancer *Balancer
+		servers  []*httptest.Server
+		received chan string
+		client   *http.Client
+	)
+
+	// serve starts an instance of ORDERS that echoes the request body and
+	// reports its own name.
+	serve := func(id string) *Instance {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			received <- id
+			w.Write([]byte(id + ":" + r.URL.Path + ":" + string(body)))
+		}))
+		servers = append(servers, server)
+
+		host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		p, err := strconv.Atoi(port)
+		Expect(err).ToNot(HaveOccurred())
+
+		return &Instance{ID: id, IPAddr: host, Port: Port(p), Status: StatusUp}
+	}
+
+	// unreachable returns an instance of ORDERS that refuses connections.
+	unreachable := func(id string) *Instance {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		port := l.Addr().(*net.TCPAddr).Port
+		l.Close()
+
+		return &Instance{ID: id, IPAddr: "127.0.0.1", Port: Port(port), Status: StatusUp}
+	}
+
+	start := func(instances ...*Instance) {
+		registry.Register(&App{Name: "ORDERS", Instances: instances})
+		balancer = NewBalancer(registry, interval, BalancerSelector(retry.RoundRobin))
+		client = &http.Client{Transport: balancer}
+	}
+
+	BeforeEach(func() {
+		registry = newMockRegistry()
+		servers = nil
+		received = make(chan string, 10)
+	})
+
+	AfterEach(func() {
+		if balancer != nil {
+			balancer.Stop()
+			balancer = nil
+		}
+
+		for _, s := range servers {
+			s.Close()
+		}
+	})
+
+	body := func(resp *http.Response, err error) string {
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		return string(b)
+	}
+
+	It("sends requests to instances of the app named by the host", func() {
+		start(serve("one"))
+
+		Expect(body(client.Get("http://orders/api/orders"))).To(Equal("one:/api/orders:"))
+	})
+
+	It("picks instances using the selector", func() {
+		start(serve("one"), serve("two"))
+
+		Expect(body(client.Get("http://ORDERS/"))).To(Equal("one:/:"))
+		Expect(body(client.Get("http://ORDERS/"))).To(Equal("one:/:"))
+
+		balancer.Stop()
+		balancer = NewBalancer(registry, interval, BalancerSelector(func(endpoints []string) retry.Endpoint {
+			return func(_ uint) string {
+				return endpoints[len(endpoints)-1]
+			}
+		}))
+		client.Transport = balancer
+
+		Expect(body(client.Get("http://ORDERS/"))).To(Equal("two:/:"))
+	})
+
+	It("only uses instances that are up", func() {
+		down := serve("two")
+		down.Status = StatusDown
+
+		start(down, serve("one"))
+
+		for n := 0; n < 3; n++ {
+			Expect(body(client.Get("http://ORDERS/"))).To(Equal("one:/:"))
+		}
+	})
+
+	It("follows changes of the registry", func() {
+		start(serve("one"))
+		Expect(body(client.Get("http://ORDERS/"))).To(Equal("one:/:"))
+
+		registry.Register(&App{Name: "ORDERS", Instances: []*Instance{serve("two")}})
+		Eventually(func() string {
+			return body(client.Get("http://ORDERS/"))
+		}).Should(Equal("two:/:"))
+	})
+
+	It("fails if no instance is up", func() {
+		start(serve("one"))
+
+		_, err := client.Get("http://PAYMENTS/")
+		Expect(errors.Is(err, ErrNoInstances)).To(BeTrue())
+	})
+
+	It("retries idempotent requests on another instance", func() {
+		start(unreachable("one"), serve("two"))
+
+		Expect(body(client.Get("http://ORDERS/"))).To(Equal("two:/:"))
+	})
+
+	It("rewinds the body of retried requests", func() {
+		start(unreachable("one"), serve("two"))
+
+		req, err := http.NewRequest(http.MethodPut, "http://ORDERS/", strings.NewReader("payload"))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(body(client.Do(req))).To(Equal("two:/:payload"))
+	})
+
+	It("retries requests that carry an idempotency key", func() {
+		start(unreachable("one"), serve("two"))
+
+		req, err := http.NewRequest(http.MethodPost, "http://ORDERS/", strings.NewReader("payload"))
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("Idempotency-Key", "abc")
+
+		Expect(body(client.Do(req))).To(Equal("two:/:payload"))
+	})
+
+	It("does not retry other requests", func() {
+		start(unreachable("one"), serve("two"))
+
+		_, err := client.Post("http://ORDERS/", "text/plain", strings.NewReader("payload"))
+		Expect(err).To(HaveOccurred())
+		Expect(received).ToNot(Receive())
+	})
+
+	It("does not try an instance twice", func() {
+		start(unreachable("one"), unreachable("two"))
+
+		_, err := client.Get("http://ORDERS/")
+
+		var attempts *retry.AttemptsError
+		Expect(errors.As(err, &attempts)).To(BeTrue())
+		Expect(attempts.Attempts).To(HaveLen(2))
+	})
+})
@@ -0,0 +1,173 @@
+package eureka
+
+import "time"
+
+// eventEndOfPoll marks the end of a poll cycle in the queue of a batch
+// subscription. It is never delivered.
+const eventEndOfPoll EventType = 255
+
+// DefaultBatchMaxDelayFactor defines after how many windows a batch is
+// delivered although events keep arriving, unless a different delay has been
+// set using WatchBatchMaxDelay.
+const DefaultBatchMaxDelayFactor = 10
+
+// Batch holds events that are delivered at once, see SubscribeBatches.
+type Batch struct {
+	Events []Event
+
+	// Counts holds the number of events per type.
+	Counts map[EventType]int
+}
+
+// WatchFlapping collapses registrations and deregistrations of the same
+// instance that occur within the given window. Registrations and
+// deregistrations are held back for the duration of the window. An instance
+// that is deregistered within the window of its registration is not reported
+// at all, an instance that reappears within the window of its deregistration
+// is reported as updated, if it has changed.
+func WatchFlapping(window time.Duration) WatchOption {
+	return func(w *Watcher) {
+		w.flapping = window
+	}
+}
+
+// WatchBatchMaxDelay limits how long a batch subscription with a window
+// collects events, i.e. a batch is delivered once the given delay has passed
+// since its first event, even if events keep arriving. Defaults to
+// DefaultBatchMaxDelayFactor times the window.
+func WatchBatchMaxDelay(max time.Duration) WatchOption {
+	return func(w *Watcher) {
+		w.batchMaxDelay = max
+	}
+}
+
+// SubscribeBatches adds a subscriber to the watcher that receives events in
+// batches, see Subscribe. If window is zero, a batch holds the events
+// observed by a single poll of the registry. Otherwise, events are collected
+// until no further events have been observed for the duration of the window,
+// but no longer than the maximum delay, see WatchBatchMaxDelay. Events for
+// the same instance are merged within a batch, e.g. a batch only holds the
+// latest update of an instance.
+func (w *Watcher) SubscribeBatches(window time.Duration, options ...WatchOption) *Subscription {
+	s := w.newSubscription(subscriptionConfig(options))
+	s.batches = make(chan Batch)
+	s.window = window
+	if s.maxDelay <= 0 {
+		s.maxDelay = DefaultBatchMaxDelayFactor * window
+	}
+	return w.subscribe(s)
+}
+
+// Batches returns the channel the subscription receives batches of events on.
+// The channel is closed when the subscription is cancelled or the watcher
+// stops. It returns nil for subscriptions not created by SubscribeBatches.
+func (s *Subscription) Batches() <-chan Batch {
+	return s.batches
+}
+
+// endPoll marks the end of a poll cycle for batch subscriptions that are
+// batching per poll.
+func (w *Watcher) endPoll() {
+	w.subMtx.Lock()
+	subs := w.subs
+	w.subMtx.Unlock()
+
+	for _, s := range subs {
+		if s.batches != nil && s.window == 0 {
+			s.queue.push(s.ctx, "", Event{Type: eventEndOfPoll})
+		}
+	}
+}
+
+// held checks if the flapping suppressor holds back an event.
+func (s *Subscription) held(item queuedEvent, now time.Time) bool {
+	if s.flapping <= 0 {
+		return false
+	}
+
+	switch item.event.Type {
+	case EventInstanceRegistered, EventInstanceDeregistered:
+		return now.Before(item.at.Add(s.flapping))
+	}
+
+	return false
+}
+
+// deadline returns the point in time pending events are due.
+func (s *Subscription) deadline(pending *eventQueue, quiet time.Time) (time.Time, bool) {
+	if pending.count() == 0 {
+		return time.Time{}, false
+	}
+
+	var (
+		deadline time.Time
+		found    bool
+	)
+
+	due := func(t time.Time) {
+		if !found || t.Before(deadline) {
+			deadline, found = t, true
+		}
+	}
+
+	if s.batches != nil && s.window > 0 {
+		due(quiet)
+	}
+
+	if s.batches == nil && s.flapping > 0 {
+		for _, item := range pending.items {
+			if s.held(item, item.at) {
+				due(item.at.Add(s.flapping))
+			}
+		}
+	}
+
+	return deadline, found
+}
+
+// release delivers the pending events that are due. It returns false if the
+// subscription has been cancelled.
+func (s *Subscription) release(pending *eventQueue, now, quiet time.Time, endOfPoll bool) bool {
+	switch {
+	case s.batches == nil:
+	case s.window > 0 && now.Before(quiet):
+		return true
+	case s.window == 0 && !endOfPoll:
+		return true
+	}
+
+	items := pending.take(func(item queuedEvent) bool {
+		return !s.held(item, now)
+	})
+
+	if len(items) == 0 {
+		return true
+	}
+
+	if s.batches == nil {
+		for _, item := range items {
+			if !s.send(item.event) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	batch := Batch{
+		Events: make([]Event, 0, len(items)),
+		Counts: make(map[EventType]int),
+	}
+
+	for _, item := range items {
+		batch.Events = append(batch.Events, item.event)
+		batch.Counts[item.event.Type]++
+	}
+
+	select {
+	case s.batches <- batch:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
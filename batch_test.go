@@ -0,0 +1,192 @@
+package eureka
+
+import (
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Batches", func() {
+	var (
+		interval = 10 * time.Millisecond
+		registry *mockRegistry
+		watcher  *Watcher
+		one, two *Instance
+	)
+
+	BeforeEach(func() {
+		one = &Instance{ID: "one"}
+		two = &Instance{ID: "two"}
+
+		registry = newMockRegistry()
+		registry.Register(&App{Name: "app", Instances: []*Instance{one, two}})
+
+		watcher = NewWatcher(registry, interval)
+	})
+
+	AfterEach(func() {
+		watcher.Stop()
+	})
+
+	It("delivers the events of a poll at once", func() {
+		s := watcher.SubscribeBatches(0)
+		Expect(s.Events()).To(BeNil())
+
+		var batch Batch
+		Eventually(s.Batches()).Should(Receive(&batch))
+		Expect(batch.Events).To(ConsistOf(
+			Event{EventInstanceRegistered, one, nil},
+			Event{EventInstanceRegistered, two, nil},
+		))
+		Expect(batch.Counts).To(Equal(map[EventType]int{EventInstanceRegistered: 2}))
+
+		changed := &Instance{ID: "one", HostName: "changed"}
+		registry.Register(&App{Name: "app", Instances: []*Instance{changed}})
+
+		Eventually(s.Batches()).Should(Receive(&batch))
+		Expect(batch.Events).To(ConsistOf(
+			Event{EventInstanceUpdated, changed, one},
+			Event{EventInstanceDeregistered, two, nil},
+		))
+		Expect(batch.Counts).To(Equal(map[EventType]int{
+			EventInstanceUpdated:      1,
+			EventInstanceDeregistered: 1,
+		}))
+
+		Consistently(s.Batches()).ShouldNot(Receive())
+	})
+
+	It("collects events until they settle down", func() {
+		s := watcher.SubscribeBatches(100 * time.Millisecond)
+
+		var batch Batch
+		Eventually(s.Batches()).Should(Receive(&batch))
+		Expect(batch.Events).To(HaveLen(2))
+
+		// a rolling deploy
+		three := &Instance{ID: "three"}
+		registry.Register(&App{Name: "app", Instances: []*Instance{one, two, three}})
+		time.Sleep(3 * interval)
+		registry.Register(&App{Name: "app", Instances: []*Instance{two, three}})
+		time.Sleep(3 * interval)
+		registry.Register(&App{Name: "app", Instances: []*Instance{three}})
+
+		Eventually(s.Batches(), time.Second).Should(Receive(&batch))
+		Expect(batch.Events).To(ConsistOf(
+			Event{EventInstanceRegistered, three, nil},
+			Event{EventInstanceDeregistered, one, nil},
+			Event{EventInstanceDeregistered, two, nil},
+		))
+		Expect(batch.Counts).To(Equal(map[EventType]int{
+			EventInstanceRegistered:   1,
+			EventInstanceDeregistered: 2,
+		}))
+	})
+
+	It("collapses instances that come and go within the window", func() {
+		s := watcher.SubscribeBatches(100 * time.Millisecond)
+		Eventually(s.Batches()).Should(Receive())
+
+		three := &Instance{ID: "three"}
+		registry.Register(&App{Name: "app", Instances: []*Instance{one, two, three}})
+		time.Sleep(3 * interval)
+		registry.Register(&App{Name: "app", Instances: []*Instance{one, two}})
+
+		Consistently(s.Batches(), 300*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("delivers batches after the maximum delay while events keep arriving", func() {
+		s := watcher.SubscribeBatches(100*time.Millisecond, WatchBatchMaxDelay(200*time.Millisecond))
+		Eventually(s.Batches()).Should(Receive())
+
+		stop := make(chan struct{})
+		defer close(stop)
+
+		// keeps changing an instance faster than the window
+		go func(registry *mockRegistry) {
+			for n := 0; ; n++ {
+				select {
+				case <-stop:
+					return
+				case <-time.After(3 * interval):
+				}
+
+				changed := &Instance{ID: "one", HostName: strconv.Itoa(n)}
+				registry.Register(&App{Name: "app", Instances: []*Instance{changed, two}})
+			}
+		}(registry)
+
+		var batch Batch
+		Eventually(s.Batches(), 500*time.Millisecond).Should(Receive(&batch))
+		Expect(batch.Counts).To(Equal(map[EventType]int{EventInstanceUpdated: 1}))
+	})
+})
+
+var _ = Describe("Flapping suppressor", func() {
+	var (
+		interval = 10 * time.Millisecond
+		window   = 100 * time.Millisecond
+		registry *mockRegistry
+		watcher  *Watcher
+		one, two *Instance
+	)
+
+	BeforeEach(func() {
+		one = &Instance{ID: "one"}
+		two = &Instance{ID: "two"}
+
+		registry = newMockRegistry()
+		registry.Register(&App{Name: "app", Instances: []*Instance{one}})
+
+		watcher = NewWatcher(registry, interval, WatchFlapping(window))
+		Eventually(watcher.Events(), time.Second).Should(Receive())
+	})
+
+	AfterEach(func() {
+		watcher.Stop()
+	})
+
+	It("holds back registrations for the duration of the window", func() {
+		start := time.Now()
+		registry.Register(&App{Name: "app", Instances: []*Instance{one, two}})
+
+		Eventually(watcher.Events(), time.Second).Should(Receive(Equal(Event{EventInstanceRegistered, two, nil})))
+		Expect(time.Since(start)).To(BeNumerically(">=", window))
+	})
+
+	It("drops instances that register and deregister within the window", func() {
+		registry.Register(&App{Name: "app", Instances: []*Instance{one, two}})
+		time.Sleep(3 * interval)
+		registry.Register(&App{Name: "app", Instances: []*Instance{one}})
+
+		Consistently(watcher.Events(), 3*window).ShouldNot(Receive())
+	})
+
+	It("drops instances that deregister and reappear within the window", func() {
+		registry.Deregister("app")
+		time.Sleep(3 * interval)
+		registry.Register(&App{Name: "app", Instances: []*Instance{one}})
+
+		Consistently(watcher.Events(), 3*window).ShouldNot(Receive())
+	})
+
+	It("does not hold back updates", func() {
+		changed := &Instance{ID: "one", HostName: "changed"}
+		registry.Register(&App{Name: "app", Instances: []*Instance{changed}})
+
+		Eventually(watcher.Events(), window/2).Should(Receive(Equal(Event{EventInstanceUpdated, changed, one})))
+	})
+
+	It("applies to subscriptions", func() {
+		s := watcher.Subscribe(WatchFlapping(window))
+		Eventually(s.Events(), time.Second).Should(Receive())
+
+		registry.Register(&App{Name: "app", Instances: []*Instance{one, two}})
+		time.Sleep(3 * interval)
+		registry.Register(&App{Name: "app", Instances: []*Instance{one}})
+
+		Consistently(s.Events(), 3*window).ShouldNot(Receive())
+	})
+})
@@ -0,0 +1,214 @@
+package eureka_test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/st3v/go-eureka"
+	"github.com/st3v/go-eureka/fake"
+	"github.com/st3v/go-eureka/retry"
+)
+
+func BenchmarkAppsGzip(b *testing.B) {
+	benchmarkApps(b, true)
+}
+
+func BenchmarkAppsPlain(b *testing.B) {
+	benchmarkApps(b, false)
+}
+
+func benchmarkApps(b *testing.B, gzip bool) {
+	registry := fake.NewRegistry()
+	populate(b, registry.Client(), 100, 10)
+
+	server := httptest.NewServer(registry.HTTPServer("", false).Handler)
+	defer server.Close()
+
+	// transparent compression is disabled to measure the effect of the
+	// client's own gzip negotiation
+	var received int64
+	transport := &http.Transport{
+		DisableCompression: true,
+		Dial: func(network, addr string) (net.Conn, error) {
+			conn, err := net.Dial(network, addr)
+			return &countingConn{conn, &received}, err
+		},
+	}
+
+	client := eureka.NewClient(
+		[]string{server.URL},
+		eureka.HTTPTransport(transport),
+		eureka.Gzip(gzip),
+		eureka.RetryLimit(retry.NoRetries()),
+	)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := client.Apps(); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportMetric(float64(atomic.LoadInt64(&received))/float64(b.N), "wire-bytes/op")
+}
+
+func BenchmarkWatcherUpdateStream10k(b *testing.B) {
+	client, done := appsFixtureServer(b, 10000)
+	defer done()
+
+	benchmarkWatcherUpdate(b, client, 10000)
+}
+
+func BenchmarkWatcherUpdateApps10k(b *testing.B) {
+	client, done := appsFixtureServer(b, 10000)
+	defer done()
+
+	benchmarkWatcherUpdate(b, appsOnly{client}, 10000)
+}
+
+func BenchmarkWatcherUpdateStreamFiltered10k(b *testing.B) {
+	client, done := appsFixtureServer(b, 10000)
+	defer done()
+
+	benchmarkWatcherUpdate(b, client, 10000, eureka.WatchVIPs("app-0"))
+}
+
+func BenchmarkWatcherUpdateAppsFiltered10k(b *testing.B) {
+	client, done := appsFixtureServer(b, 10000)
+	defer done()
+
+	benchmarkWatcherUpdate(b, appsOnly{client}, 10000, eureka.WatchVIPs("app-0"))
+}
+
+// benchmarkWatcherUpdate reports the heap in use while a watcher processes
+// the last instance of a poll of the given registry, i.e. the instances the
+// watcher keeps plus whatever the registry holds on to while reading them.
+func benchmarkWatcherUpdate(b *testing.B, registry eureka.Registry, numInstances int, options ...eureka.WatchOption) {
+	var base, peak runtime.MemStats
+	var total uint64
+
+	source := eureka.VisitRegistry(registry)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		runtime.GC()
+		runtime.ReadMemStats(&base)
+		b.StartTimer()
+
+		visited := 0
+		err := eureka.UpdateWatcher(func(visit eureka.InstanceVisitor) error {
+			return source(func(appName string, instance *eureka.Instance) error {
+				err := visit(appName, instance)
+
+				if visited++; visited == numInstances {
+					b.StopTimer()
+					runtime.GC()
+					runtime.ReadMemStats(&peak)
+					if peak.HeapAlloc > base.HeapAlloc {
+						total += peak.HeapAlloc - base.HeapAlloc
+					}
+					b.StartTimer()
+				}
+
+				return err
+			})
+		}, options...)
+
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportMetric(float64(total)/float64(b.N), "peak-heap-bytes/op")
+}
+
+// appsOnly hides the streaming methods of a registry, which makes watchers
+// decode the entire list of apps before processing it.
+type appsOnly struct {
+	registry eureka.Registry
+}
+
+func (r appsOnly) Apps() ([]*eureka.App, error) {
+	return r.registry.Apps()
+}
+
+// appsFixtureServer serves a generated list of apps holding the given number
+// of instances in total.
+func appsFixtureServer(b *testing.B, numInstances int) (*eureka.Client, func()) {
+	registry := fake.NewClient()
+	populate(b, registry, numInstances/10, 10)
+
+	apps, err := registry.Apps()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	body, err := xml.Marshal(eureka.AppsResponse{Apps: apps})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write(body)
+	}))
+
+	client := eureka.NewClient(
+		[]string{server.URL},
+		eureka.RetryLimit(retry.NoRetries()),
+		eureka.HTTPTimeout(time.Minute),
+	)
+
+	return client, server.Close
+}
+
+func populate(b *testing.B, client eureka.API, numApps, numInstances int) {
+	for a := 0; a < numApps; a++ {
+		for i := 0; i < numInstances; i++ {
+			instance := &eureka.Instance{
+				ID:             fmt.Sprintf("instance-%d-%d", a, i),
+				AppName:        fmt.Sprintf("APP-%d", a),
+				HostName:       fmt.Sprintf("host-%d-%d.example.com", a, i),
+				IPAddr:         fmt.Sprintf("10.0.%d.%d", a%256, i%256),
+				VIPAddr:        fmt.Sprintf("app-%d", a),
+				Status:         eureka.StatusUp,
+				Port:           8080,
+				SecurePort:     8443,
+				HomePageURL:    fmt.Sprintf("http://host-%d-%d.example.com:8080/", a, i),
+				StatusPageURL:  fmt.Sprintf("http://host-%d-%d.example.com:8080/info", a, i),
+				HealthCheckURL: fmt.Sprintf("http://host-%d-%d.example.com:8080/health", a, i),
+				LeaseInfo: eureka.Lease{
+					RenewalInterval:  eureka.Duration(30 * time.Second),
+					Duration:         eureka.Duration(90 * time.Second),
+					RegistrationTime: eureka.Time(time.Unix(1468519783, 0)),
+					LastRenewalTime:  eureka.Time(time.Unix(1468519783, 0)),
+				},
+				Metadata: eureka.Metadata{"zone": "zone-a"},
+			}
+
+			if err := client.Register(instance); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+type countingConn struct {
+	net.Conn
+	count *int64
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	atomic.AddInt64(c.count, int64(n))
+	return n, err
+}
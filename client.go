@@ -2,10 +2,14 @@ package eureka
 
 import (
 	"bytes"
+	"compress/gzip"
 	"crypto/tls"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,16 +20,70 @@ import (
 	"github.com/st3v/go-eureka/retry"
 )
 
+// API defines the operations supported by a Eureka client. It is implemented
+// by Client and can be used to substitute a Client in tests, e.g. with the
+// in-memory implementation provided by the fake package.
+type API interface {
+	Register(instance *Instance) error
+	Deregister(instance *Instance) error
+	Heartbeat(instance *Instance) error
+	Watch(pollInterval time.Duration, options ...WatchOption) *Watcher
+	Apps() ([]*App, error)
+	VisitApps(visit AppVisitor) error
+	VisitInstances(visit InstanceVisitor) error
+	App(appName string) (*App, error)
+	AppInstance(appName, instanceID string) (*Instance, error)
+	Instance(instanceID string) (*Instance, error)
+	StatusOverride(instance *Instance, status Status) error
+	RemoveStatusOverride(instance *Instance, fallback Status) error
+}
+
+var _ API = new(Client)
+
+// ErrNotFound can be used with errors.Is to check whether a requested app or
+// instance is not registered.
+var ErrNotFound = errors.New("Not found")
+
+// ResponseError is returned if the Eureka server responds with an unexpected
+// status code.
+type ResponseError struct {
+	StatusCode int
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("Unexpected response code %d", e.StatusCode)
+}
+
+// Is reports whether the response indicates that the requested resource has
+// not been found, i.e. whether target is ErrNotFound and the status is 404.
+func (e *ResponseError) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// AppVisitor is called for every app while a list of apps is being decoded.
+// Returning an error stops the decoding.
+type AppVisitor func(app *App) error
+
+// InstanceVisitor is called for every instance while a list of apps is being
+// decoded. Returning an error stops the decoding.
+type InstanceVisitor func(appName string, instance *Instance) error
+
 type Client struct {
 	endpoints     []string
 	retrySelector retry.Selector
+	retryFeedback retry.Feedback
+	observers     []retry.Observer
 	retryLimit    retry.Allow
 	retryDelay    retry.Delay
+	statefulLimit retry.StatefulAllow
+	statefulDelay retry.StatefulDelay
 	httpClient    *http.Client
 	timeout       time.Duration
 	transport     *http.Transport
 	oauth2Config  *clientcredentials.Config
 	tlsConfig     *tls.Config
+	gzip          bool
+	maxRetryAfter time.Duration
 }
 
 func NewClient(endpoints []string, options ...Option) *Client {
@@ -40,6 +98,8 @@ func NewClient(endpoints []string, options ...Option) *Client {
 		retrySelector: DefaultRetrySelector,
 		retryLimit:    DefaultRetryLimit,
 		retryDelay:    DefaultRetryDelay,
+		gzip:          true,
+		maxRetryAfter: DefaultMaxRetryAfter,
 	}
 
 	for _, opt := range options {
@@ -89,8 +149,8 @@ func (c *Client) Heartbeat(instance *Instance) error {
 
 // Watch returns a new watcher that keeps polling the registry at the defined
 // interval and reports observed changes on its Events() channel.
-func (c *Client) Watch(pollInterval time.Duration) *Watcher {
-	return newWatcher(c, pollInterval)
+func (c *Client) Watch(pollInterval time.Duration, options ...WatchOption) *Watcher {
+	return NewWatcher(c, pollInterval, options...)
 }
 
 func (c *Client) Apps() ([]*App, error) {
@@ -102,6 +162,61 @@ func (c *Client) Apps() ([]*App, error) {
 	return result.Apps, nil
 }
 
+// Delta retrieves the changes to the registry within the recent past, as
+// tracked by the registry. The action type of each instance describes the
+// change. The hashcode of the response reflects the entire registry once the
+// changes have been applied.
+func (c *Client) Delta() (*AppsResponse, error) {
+	result := new(AppsResponse)
+	if err := c.retry(c.get(c.deltaPath(), result)); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// VisitApps retrieves all registered apps and calls visit for each of them as
+// soon as it has been decoded, i.e. without holding the entire list in memory.
+// Errors returned by visit are not retried. Note however that a retried request
+// might cause apps to be visited more than once.
+func (c *Client) VisitApps(visit AppVisitor) error {
+	var stop error
+	return c.visit(&stop, func(app *App) error {
+		stop = visit(app)
+		return stop
+	}, nil)
+}
+
+// VisitInstances retrieves all registered apps and calls visit for each of
+// their instances as soon as it has been decoded. Instances are decoded one at
+// a time, which keeps memory consumption low for large registries as long as
+// visit does not retain every instance. Errors
+// returned by visit are not retried. Note however that a retried request might
+// cause instances to be visited more than once.
+func (c *Client) VisitInstances(visit InstanceVisitor) error {
+	var stop error
+	return c.visit(&stop, nil, func(appName string, instance *Instance) error {
+		stop = visit(appName, instance)
+		return stop
+	})
+}
+
+func (c *Client) visit(stop *error, visitApp AppVisitor, visitInstance InstanceVisitor) error {
+	err := c.retry(c.stream(c.appsPath(), func(r io.Reader) error {
+		// do not retry if the visitor asked to stop
+		if err := decodeApps(r, visitApp, visitInstance); err != nil && err != *stop {
+			return err
+		}
+		return nil
+	}))
+
+	if *stop != nil {
+		return *stop
+	}
+
+	return err
+}
+
 func (c *Client) App(appName string) (*App, error) {
 	app := new(App)
 	err := c.retry(c.get(c.appPath(appName), app))
@@ -129,7 +244,22 @@ func (c *Client) RemoveStatusOverride(instance *Instance, fallback Status) error
 }
 
 func (c *Client) retry(action retry.Action) error {
-	return retry.NewStrategy(c.retrySelector(c.endpoints), c.retryLimit, c.retryDelay).Apply(action)
+	allow := c.statefulLimit
+	if allow == nil {
+		allow = c.retryLimit.Stateful()
+	}
+
+	delay := c.statefulDelay
+	if delay == nil {
+		delay = c.retryDelay.Stateful()
+	}
+
+	observers := c.observers
+	if c.retryFeedback != nil {
+		observers = append(observers[:len(observers):len(observers)], retry.FeedbackObserver(c.retryFeedback))
+	}
+
+	return retry.NewStatefulStrategy(c.retrySelector(c.endpoints), allow, delay, observers...).Apply(action)
 }
 
 func (c *Client) do(method, path string, body []byte, respCode int) retry.Action {
@@ -146,9 +276,10 @@ func (c *Client) do(method, path string, body []byte, respCode int) retry.Action
 		if err != nil {
 			return err
 		}
+		defer resp.Body.Close()
 
 		if resp.StatusCode != respCode {
-			return fmt.Errorf("Unexpected response code %d", resp.StatusCode)
+			return c.responseError(resp)
 		}
 
 		return nil
@@ -156,6 +287,12 @@ func (c *Client) do(method, path string, body []byte, respCode int) retry.Action
 }
 
 func (c *Client) get(path string, result interface{}) retry.Action {
+	return c.stream(path, func(r io.Reader) error {
+		return xml.NewDecoder(r).Decode(result)
+	})
+}
+
+func (c *Client) stream(path string, decode func(io.Reader) error) retry.Action {
 	return func(endpoint string) error {
 		req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s", endpoint, path), nil)
 		if err != nil {
@@ -164,28 +301,94 @@ func (c *Client) get(path string, result interface{}) retry.Action {
 
 		req.Header.Add("Accept", "application/xml")
 
+		// setting the header explicitly disables transparent decompression
+		// in the transport, responses are therefore being decoded below
+		if c.gzip {
+			req.Header.Add("Accept-Encoding", "gzip")
+		}
+
 		resp, err := c.httpClient.Do(req)
 		if err != nil {
 			return err
 		}
+		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("Unexpected response code %d", resp.StatusCode)
+			return c.responseError(resp)
 		}
 
-		defer resp.Body.Close()
-		if err := xml.NewDecoder(resp.Body).Decode(result); err != nil {
+		body, err := responseBody(resp)
+		if err != nil {
 			return err
 		}
+		defer body.Close()
 
-		return nil
+		return decode(body)
+	}
+}
+
+// responseError returns the error for an unexpected response. If the server
+// asked to retry after a given time, the error requests a corresponding delay
+// before the next attempt, limited to the client's maxRetryAfter.
+func (c *Client) responseError(resp *http.Response) error {
+	err := &ResponseError{StatusCode: resp.StatusCode}
+
+	delay, ok := retryAfter(resp)
+	if !ok || c.maxRetryAfter <= 0 {
+		return err
+	}
+
+	if delay > c.maxRetryAfter {
+		delay = c.maxRetryAfter
 	}
+
+	return retry.After(err, delay)
+}
+
+// retryAfter parses the Retry-After header of a response, which is given
+// either in seconds or as an HTTP date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		delay := t.Sub(time.Now())
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
+
+// responseBody returns a reader for the response body that takes care of
+// decompressing the body if required.
+func responseBody(resp *http.Response) (io.ReadCloser, error) {
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return gzip.NewReader(resp.Body)
+	}
+
+	return resp.Body, nil
 }
 
 func (c *Client) appsPath() string {
 	return "apps"
 }
 
+func (c *Client) deltaPath() string {
+	return "apps/delta"
+}
+
 func (c *Client) appPath(appName string) string {
 	return fmt.Sprintf("%s/%s", c.appsPath(), appName)
 }
@@ -1,7 +1,10 @@
 package eureka_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -84,7 +87,102 @@ var _ = Describe("client", func() {
 
 			It("returns an error", func() {
 				err := client.Register(instance)
-				Expect(err).To(MatchError("Unexpected response code 500"))
+				Expect(err).To(MatchError("Unexpected response code 500 (3 attempts)"))
+			})
+		})
+
+		Context("when a retry observer is installed", func() {
+			var observer *countingObserver
+
+			BeforeEach(func() {
+				observer = new(countingObserver)
+				client = eureka.NewClient(
+					[]string{server.URL()},
+					eureka.RetryLimit(retry.MaxRetries(numRetries)),
+					eureka.RetryDelay(retry.NoDelay()),
+					eureka.RetryObserver(observer),
+				)
+				statusCode = http.StatusInternalServerError
+			})
+
+			It("notifies the observer about every attempt", func() {
+				client.Register(instance)
+
+				Expect(observer.before).To(Equal(numRetries))
+				Expect(observer.errors).To(HaveLen(numRetries))
+				Expect(observer.errors[0]).To(MatchError("Unexpected response code 500"))
+			})
+		})
+
+		Context("when using an adaptive retry selector", func() {
+			var selector *retry.LatencySelector
+
+			BeforeEach(func() {
+				selector = retry.NewLatencySelector(retry.DefaultLatencyDecay, 0, nil)
+				client = eureka.NewClient(
+					[]string{server.URL()},
+					eureka.RetryLimit(retry.MaxRetries(numRetries)),
+					eureka.RetryDelay(retry.NoDelay()),
+					eureka.AdaptiveRetrySelector(selector),
+				)
+				statusCode = http.StatusInternalServerError
+			})
+
+			It("reports every attempt to the selector", func() {
+				client.Register(instance)
+
+				scores := selector.Scores()
+				Expect(scores).To(HaveLen(1))
+				Expect(scores[0].Endpoint).To(Equal(server.URL()))
+				Expect(scores[0].Samples).To(Equal(uint64(numRetries)))
+				Expect(scores[0].ErrorRate).To(BeNumerically("==", 1))
+			})
+		})
+
+		Context("when the server asks to retry later", func() {
+			BeforeEach(func() {
+				client = eureka.NewClient(
+					[]string{server.URL()},
+					eureka.RetryLimit(retry.MaxRetries(numRetries)),
+					eureka.RetryDelay(retry.NoDelay()),
+					eureka.MaxRetryAfter(50*time.Millisecond),
+				)
+
+				server.SetHandler(0, ghttp.RespondWith(http.StatusServiceUnavailable, nil, http.Header{
+					"Retry-After": []string{"120"},
+				}))
+			})
+
+			It("waits for the requested delay, limited to the upper bound", func() {
+				start := time.Now()
+				err := client.Register(instance)
+				elapsed := time.Since(start)
+
+				Expect(err).ToNot(HaveOccurred())
+				Expect(server.ReceivedRequests()).To(HaveLen(2))
+				Expect(elapsed).To(BeNumerically(">=", 50*time.Millisecond))
+				Expect(elapsed).To(BeNumerically("<", time.Second))
+			})
+
+			It("tries other servers right away", func() {
+				healthy := ghttp.NewServer()
+				defer healthy.Close()
+				healthy.AppendHandlers(ghttp.RespondWith(http.StatusNoContent, nil))
+
+				client = eureka.NewClient(
+					[]string{server.URL(), healthy.URL()},
+					eureka.RetryLimit(retry.MaxRetries(numRetries)),
+					eureka.RetryDelay(retry.NoDelay()),
+					eureka.RetrySelector(retry.RoundRobin),
+				)
+
+				start := time.Now()
+				err := client.Register(instance)
+
+				Expect(err).ToNot(HaveOccurred())
+				Expect(server.ReceivedRequests()).To(HaveLen(1))
+				Expect(healthy.ReceivedRequests()).To(HaveLen(1))
+				Expect(time.Since(start)).To(BeNumerically("<", time.Second))
 			})
 		})
 	})
@@ -125,7 +223,7 @@ var _ = Describe("client", func() {
 
 			It("returns an error", func() {
 				err := client.Deregister(instance)
-				Expect(err).To(MatchError("Unexpected response code 500"))
+				Expect(err).To(MatchError("Unexpected response code 500 (3 attempts)"))
 			})
 		})
 	})
@@ -166,7 +264,7 @@ var _ = Describe("client", func() {
 
 			It("returns an error", func() {
 				err := client.Heartbeat(instance)
-				Expect(err).To(MatchError("Unexpected response code 500"))
+				Expect(err).To(MatchError("Unexpected response code 500 (3 attempts)"))
 			})
 		})
 	})
@@ -215,6 +313,46 @@ var _ = Describe("client", func() {
 			Expect(apps[1]).To(Equal(app))
 		})
 
+		It("requests a gzip compressed response", func() {
+			server.SetHandler(0, ghttp.CombineHandlers(
+				ghttp.VerifyHeaderKV("Accept-Encoding", "gzip"),
+				server.GetHandler(0),
+			))
+
+			_, err := client.Apps()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		Context("when the server compresses the response", func() {
+			BeforeEach(func() {
+				body, err := xml.Marshal(eureka.AppsResponse{
+					Apps: []*eureka.App{app, app},
+				})
+				Expect(err).ToNot(HaveOccurred())
+
+				var compressed bytes.Buffer
+				w := gzip.NewWriter(&compressed)
+				_, err = w.Write(body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(w.Close()).To(Succeed())
+
+				server.SetHandler(0, ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/apps"),
+					ghttp.RespondWith(http.StatusOK, compressed.Bytes(), http.Header{
+						"Content-Encoding": []string{"gzip"},
+					}),
+				))
+			})
+
+			It("decompresses the response", func() {
+				apps, err := client.Apps()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(apps).To(HaveLen(2))
+				Expect(apps[0]).To(Equal(app))
+				Expect(apps[1]).To(Equal(app))
+			})
+		})
+
 		Context("when the request fails", func() {
 			BeforeEach(func() {
 				statusCode = http.StatusInternalServerError
@@ -227,7 +365,265 @@ var _ = Describe("client", func() {
 
 			It("returns an error", func() {
 				_, err := client.Apps()
-				Expect(err).To(MatchError("Unexpected response code 500"))
+				Expect(err).To(MatchError("Unexpected response code 500 (3 attempts)"))
+			})
+		})
+
+		Context("when the server is unavailable", func() {
+			BeforeEach(func() {
+				client = eureka.NewClient(
+					[]string{server.URL()},
+					eureka.RetryLimit(retry.MaxRetries(numRetries)),
+					eureka.RetryDelay(retry.NoDelay()),
+				)
+
+				date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+				server.SetHandler(0, ghttp.RespondWith(http.StatusServiceUnavailable, nil, http.Header{
+					"Retry-After": []string{date},
+				}))
+			})
+
+			It("honours a Retry-After date, limited to the upper bound", func() {
+				client = eureka.NewClient(
+					[]string{server.URL()},
+					eureka.RetryLimit(retry.MaxRetries(numRetries)),
+					eureka.RetryDelay(retry.NoDelay()),
+					eureka.MaxRetryAfter(50*time.Millisecond),
+				)
+
+				start := time.Now()
+				_, err := client.Apps()
+				elapsed := time.Since(start)
+
+				Expect(err).ToNot(HaveOccurred())
+				Expect(elapsed).To(BeNumerically(">=", 50*time.Millisecond))
+				Expect(elapsed).To(BeNumerically("<", time.Second))
+			})
+
+			It("ignores Retry-After if the upper bound is 0", func() {
+				client = eureka.NewClient(
+					[]string{server.URL()},
+					eureka.RetryLimit(retry.MaxRetries(numRetries)),
+					eureka.RetryDelay(retry.NoDelay()),
+					eureka.MaxRetryAfter(0),
+				)
+
+				start := time.Now()
+				_, err := client.Apps()
+
+				Expect(err).ToNot(HaveOccurred())
+				Expect(time.Since(start)).To(BeNumerically("<", 50*time.Millisecond))
+			})
+		})
+	})
+
+	Describe(".Delta", func() {
+		var (
+			app        *eureka.App
+			statusCode int
+		)
+
+		BeforeEach(func() {
+			var err error
+			app, err = appFixture()
+			Expect(err).ToNot(HaveOccurred())
+
+			app.Instances[0].ActionType = eureka.ActionModified
+
+			body, err := xml.Marshal(eureka.AppsResponse{
+				VersionDelta: 7,
+				Hashcode:     "UP_1_",
+				Apps:         []*eureka.App{app},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			statusCode = http.StatusOK
+			for i := 0; i < numRetries; i++ {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", "/apps/delta"),
+						ghttp.RespondWithPtr(&statusCode, &body),
+					),
+				)
+			}
+		})
+
+		It("returns the changes", func() {
+			delta, err := client.Delta()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(server.ReceivedRequests()).To(HaveLen(1))
+
+			Expect(delta.VersionDelta).To(Equal(7))
+			Expect(delta.Hashcode).To(Equal("UP_1_"))
+			Expect(delta.Apps).To(HaveLen(1))
+			Expect(delta.Apps[0].Instances[0].ActionType).To(Equal(eureka.ActionModified))
+		})
+
+		Context("when the request fails", func() {
+			BeforeEach(func() {
+				statusCode = http.StatusInternalServerError
+			})
+
+			It("retries the request and returns an error", func() {
+				_, err := client.Delta()
+				Expect(server.ReceivedRequests()).To(HaveLen(numRetries))
+				Expect(err).To(MatchError("Unexpected response code 500 (3 attempts)"))
+			})
+		})
+	})
+
+	Describe(".VisitApps", func() {
+		var app *eureka.App
+
+		BeforeEach(func() {
+			var err error
+			app, err = appFixture()
+			Expect(err).ToNot(HaveOccurred())
+
+			response := eureka.AppsResponse{
+				Apps: []*eureka.App{app, app},
+			}
+
+			var body []byte
+			body, err = xml.Marshal(response)
+			Expect(err).ToNot(HaveOccurred())
+
+			statusCode = http.StatusOK
+			for i := 0; i < numRetries; i++ {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", "/apps"),
+						ghttp.RespondWithPtr(&statusCode, &body),
+					),
+				)
+			}
+		})
+
+		It("visits every app", func() {
+			var apps []*eureka.App
+			err := client.VisitApps(func(a *eureka.App) error {
+				apps = append(apps, a)
+				return nil
+			})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(apps).To(HaveLen(2))
+			Expect(apps[0]).To(Equal(app))
+			Expect(apps[1]).To(Equal(app))
+		})
+
+		Context("when the visitor returns an error", func() {
+			It("stops without retrying the request", func() {
+				stop := errors.New("stop")
+
+				visited := 0
+				err := client.VisitApps(func(a *eureka.App) error {
+					visited++
+					return stop
+				})
+
+				Expect(err).To(MatchError(stop))
+				Expect(visited).To(Equal(1))
+				Expect(server.ReceivedRequests()).To(HaveLen(1))
+			})
+		})
+
+		Context("when the request fails", func() {
+			BeforeEach(func() {
+				statusCode = http.StatusInternalServerError
+			})
+
+			It("retries the request", func() {
+				client.VisitApps(func(*eureka.App) error { return nil })
+				Expect(server.ReceivedRequests()).To(HaveLen(numRetries))
+			})
+
+			It("returns an error", func() {
+				err := client.VisitApps(func(*eureka.App) error { return nil })
+				Expect(err).To(MatchError("Unexpected response code 500 (3 attempts)"))
+			})
+		})
+	})
+
+	Describe(".VisitInstances", func() {
+		var app *eureka.App
+
+		BeforeEach(func() {
+			var err error
+			app, err = appFixture()
+			Expect(err).ToNot(HaveOccurred())
+
+			other, err := appFixture()
+			Expect(err).ToNot(HaveOccurred())
+			other.Name = "OTHER"
+
+			response := eureka.AppsResponse{
+				Apps: []*eureka.App{app, other},
+			}
+
+			var body []byte
+			body, err = xml.Marshal(response)
+			Expect(err).ToNot(HaveOccurred())
+
+			statusCode = http.StatusOK
+			for i := 0; i < numRetries; i++ {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", "/apps"),
+						ghttp.RespondWithPtr(&statusCode, &body),
+					),
+				)
+			}
+		})
+
+		It("visits every instance along with the name of its app", func() {
+			var (
+				names     []string
+				instances []*eureka.Instance
+			)
+
+			err := client.VisitInstances(func(name string, i *eureka.Instance) error {
+				names = append(names, name)
+				instances = append(instances, i)
+				return nil
+			})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(names).To(Equal([]string{app.Name, "OTHER"}))
+			Expect(instances).To(HaveLen(2))
+			Expect(instances[0]).To(Equal(app.Instances[0]))
+			Expect(instances[1]).To(Equal(app.Instances[0]))
+		})
+
+		Context("when the visitor returns an error", func() {
+			It("stops without retrying the request", func() {
+				stop := errors.New("stop")
+
+				visited := 0
+				err := client.VisitInstances(func(string, *eureka.Instance) error {
+					visited++
+					return stop
+				})
+
+				Expect(err).To(MatchError(stop))
+				Expect(visited).To(Equal(1))
+				Expect(server.ReceivedRequests()).To(HaveLen(1))
+			})
+		})
+
+		Context("when the request fails", func() {
+			BeforeEach(func() {
+				statusCode = http.StatusInternalServerError
+			})
+
+			It("retries the request", func() {
+				client.VisitInstances(func(string, *eureka.Instance) error { return nil })
+				Expect(server.ReceivedRequests()).To(HaveLen(numRetries))
+			})
+
+			It("returns an error", func() {
+				err := client.VisitInstances(func(string, *eureka.Instance) error { return nil })
+				Expect(err).To(MatchError("Unexpected response code 500 (3 attempts)"))
 			})
 		})
 	})
@@ -283,7 +679,22 @@ var _ = Describe("client", func() {
 
 			It("returns an error", func() {
 				_, err := client.App(app.Name)
-				Expect(err).To(MatchError("Unexpected response code 500"))
+				Expect(err).To(MatchError("Unexpected response code 500 (3 attempts)"))
+			})
+		})
+
+		Context("when the app is not registered", func() {
+			BeforeEach(func() {
+				statusCode = http.StatusNotFound
+			})
+
+			It("returns an error matching ErrNotFound", func() {
+				_, err := client.App(app.Name)
+				Expect(errors.Is(err, eureka.ErrNotFound)).To(BeTrue())
+
+				var respErr *eureka.ResponseError
+				Expect(errors.As(err, &respErr)).To(BeTrue())
+				Expect(respErr.StatusCode).To(Equal(http.StatusNotFound))
 			})
 		})
 	})
@@ -337,7 +748,7 @@ var _ = Describe("client", func() {
 
 			It("returns an error", func() {
 				_, err := client.AppInstance(instance.AppName, instance.ID)
-				Expect(err).To(MatchError("Unexpected response code 500"))
+				Expect(err).To(MatchError("Unexpected response code 500 (3 attempts)"))
 			})
 		})
 	})
@@ -391,7 +802,7 @@ var _ = Describe("client", func() {
 
 			It("returns an error", func() {
 				_, err := client.Instance(instance.ID)
-				Expect(err).To(MatchError("Unexpected response code 500"))
+				Expect(err).To(MatchError("Unexpected response code 500 (3 attempts)"))
 			})
 		})
 	})
@@ -429,7 +840,7 @@ var _ = Describe("client", func() {
 			defer watcher.Stop()
 
 			// expect exactly one registration event
-			expectedEvent := eureka.Event{eureka.EventInstanceRegistered, app.Instances[0]}
+			expectedEvent := eureka.Event{Type: eureka.EventInstanceRegistered, Instance: app.Instances[0]}
 			Eventually(watcher.Events()).Should(Receive(Equal(expectedEvent)))
 
 			// watcher keeps polling
@@ -477,7 +888,7 @@ var _ = Describe("client", func() {
 
 			It("returns an error", func() {
 				err := client.StatusOverride(instance, status)
-				Expect(err).To(MatchError("Unexpected response code 500"))
+				Expect(err).To(MatchError("Unexpected response code 500 (3 attempts)"))
 			})
 		})
 	})
@@ -520,8 +931,17 @@ var _ = Describe("client", func() {
 
 			It("returns an error", func() {
 				err := client.RemoveStatusOverride(instance, fallback)
-				Expect(err).To(MatchError("Unexpected response code 500"))
+				Expect(err).To(MatchError("Unexpected response code 500 (3 attempts)"))
 			})
 		})
 	})
 })
+
+type countingObserver struct {
+	before int
+	errors []error
+}
+
+func (o *countingObserver) Before(_ retry.Attempt) { o.before++ }
+
+func (o *countingObserver) After(a retry.Attempt) { o.errors = append(o.errors, a.Err) }
@@ -24,6 +24,7 @@ func main() {
 		instancesCmd,
 		overrideCmd,
 		removeOverrideCmd,
+		exportCmd,
 	}
 
 	app.Run(os.Args)
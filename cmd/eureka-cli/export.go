@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/codegangsta/cli"
+
+	"github.com/st3v/go-eureka"
+)
+
+const formatPrometheusSD = "prometheus-sd"
+
+var exportCmd = cli.Command{
+	Name:  "export",
+	Usage: "export registered instances for use by other tools",
+
+	Flags: []cli.Flag{
+		endpointsFlag,
+		cli.StringFlag{
+			Name:  "format, f",
+			Value: formatPrometheusSD,
+			Usage: "Output format, supported formats: " + formatPrometheusSD,
+		},
+		cli.StringSliceFlag{
+			Name:  "metadata, m",
+			Value: &cli.StringSlice{},
+			Usage: "Metadata key to be exported as label, can be repeated",
+		},
+	},
+
+	Action: func(c *cli.Context) error {
+		endpoints := getEndpoints(c, "export")
+
+		format := c.String("format")
+		if format != formatPrometheusSD {
+			cli.ShowCommandHelp(c, "export")
+			err := fmt.Errorf("Unsupported format '%s'", format)
+			log.Println(err)
+			return err
+		}
+
+		client := eureka.NewClient(endpoints)
+
+		apps, err := client.Apps()
+		if err != nil {
+			log.Printf("Error retrieving applications: %s\n", err)
+			return err
+		}
+
+		data, err := json.MarshalIndent(eureka.PrometheusTargets(apps, c.StringSlice("metadata")...), "", "  ")
+		if err != nil {
+			log.Printf("Error rendering output: %s\n", err)
+			return err
+		}
+
+		log.Println(string(data))
+		return nil
+	},
+}
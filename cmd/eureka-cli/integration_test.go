@@ -3,8 +3,10 @@
 package main_test
 
 import (
+	"encoding/json"
 	"encoding/xml"
 	"os"
+	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -95,6 +97,29 @@ var _ = Describe("CLI", func() {
 		Expect(result.Instances).To(HaveLen(1))
 		Expect(result.Contains(instances[0])).To(BeTrue())
 
+		// export for prometheus
+		session = execBin(append([]string{"export", "--format", "prometheus-sd", "-m", "key"}, endpointFlags()...)...)
+		Eventually(session).Should(gexec.Exit(0))
+
+		var groups []eureka.PrometheusTargetGroup
+		err = json.Unmarshal(session.Out.Contents(), &groups)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(groups).To(ContainElement(eureka.PrometheusTargetGroup{
+			Targets: []string{"1.2.3.4:987"},
+			Labels: map[string]string{
+				"__meta_eureka_app_name":                  strings.ToUpper(instances[0].AppName),
+				"__meta_eureka_app_instance_id":           instances[0].ID,
+				"__meta_eureka_app_instance_hostname":     "host-name",
+				"__meta_eureka_app_instance_ip_addr":      "1.2.3.4",
+				"__meta_eureka_app_instance_status":       "UP",
+				"__meta_eureka_app_instance_port":         "987",
+				"__meta_eureka_app_instance_secure_port":  "789",
+				"__meta_eureka_app_instance_vip_address":  "5.6.7.8",
+				"__meta_eureka_app_instance_metadata_key": "value",
+			},
+		}))
+
 		// heartbeat
 		session = execBin(append([]string{"heartbeat", "-i", instanceFilePaths[0]}, endpointFlags()...)...)
 		Eventually(session).Should(gexec.Exit(0))
@@ -36,7 +36,7 @@ func main() {
 	addr := fmt.Sprintf("%s:%d", host, port)
 	server := fake.NewRegistry().HTTPServer(addr, debug)
 
-	log.Println(warning)
+	log.Print(warning)
 
 	log.Printf("Listening on %s...\n", addr)
 	log.Fatal(server.ListenAndServe())
@@ -0,0 +1,299 @@
+package eureka
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// deltaRegistry is implemented by registries that report recent changes to
+// the registry, such as Client.
+type deltaRegistry interface {
+	Delta() (*AppsResponse, error)
+}
+
+// WatchDeltas makes the watcher poll the recent changes to the registry
+// instead of the entire registry, see Client.Delta. Events are derived from
+// the action types of the changes. The watcher verifies its view of the
+// registry against the hashcode reported by the registry and falls back to
+// retrieving the entire registry if they disagree, as it does on the first
+// poll or if retrieving the changes fails. Registries that do not report
+// changes, including servers that respond with 403 Forbidden or 404 Not Found
+// because deltas are disabled, are polled as usual.
+//
+// Self-preservation, see WatchSelfPreservation, only applies to polls that
+// retrieve the entire registry. With WatchLeaseExpiry, every poll diffs the
+// entire tracked registry, in order to detect expired leases. Changes do not
+// include renewed leases, the watcher therefore retrieves the entire registry
+// whenever a tracked lease appears to have expired.
+func WatchDeltas() WatchOption {
+	return func(w *Watcher) {
+		w.deltas = true
+	}
+}
+
+// deltaSource keeps track of the entire registry, regardless of the filters
+// of the watcher, in order to verify it against the registry's hashcode.
+type deltaSource struct {
+	registry    deltaRegistry
+	visit       func(InstanceVisitor) error
+	state       map[string]watched
+	unsupported bool
+}
+
+// change is a change to a single instance, as reported by a delta.
+type change struct {
+	app      string
+	key      string
+	instance *Instance
+	deleted  bool
+}
+
+// poller returns a function that polls the registry and updates the watcher.
+func (w *Watcher) poller(registry Registry) func() error {
+	if r, ok := registry.(deltaRegistry); ok && w.deltas {
+		d := &deltaSource{
+			registry: r,
+			visit:    visitInstances(registry),
+		}
+
+		return func() error {
+			return w.updateDelta(d)
+		}
+	}
+
+	visit := w.source(registry)
+	return func() error {
+		return w.update(visit)
+	}
+}
+
+// updateDelta polls the recent changes to the registry and reports them. It
+// retrieves the entire registry instead, if the watcher is out of sync.
+func (w *Watcher) updateDelta(d *deltaSource) error {
+	if d.unsupported {
+		return w.update(d.visit)
+	}
+
+	if d.state == nil {
+		return w.resync(d)
+	}
+
+	// the delta covers a window of time, changes missed due to failed polls
+	// are caught by the hashcode check
+	delta, err := d.registry.Delta()
+	if err != nil {
+		d.unsupported = deltaUnsupported(err)
+		return w.resync(d)
+	}
+
+	changes := d.apply(delta)
+
+	if hashcode(d.state) != delta.Hashcode {
+		// reconciliation failed, fall back to the entire registry
+		return w.resync(d)
+	}
+
+	if w.leases {
+		// leases expire without any changes to the registry, but renewals are
+		// missing from the delta as well
+		now := time.Now()
+		if d.expired(now) {
+			return w.resync(d)
+		}
+
+		return w.updateAt(d.visitState, now)
+	}
+
+	w.updateChanges(changes)
+	return nil
+}
+
+// deltaUnsupported checks if the registry refused to report changes, e.g.
+// because deltas have been disabled on the server.
+func deltaUnsupported(err error) bool {
+	var resp *ResponseError
+	if !errors.As(err, &resp) {
+		return false
+	}
+
+	return resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound
+}
+
+// visitState feeds the tracked state of the registry to the given visitor.
+func (d *deltaSource) visitState(visit InstanceVisitor) error {
+	for _, k := range sortedKeys(d.state) {
+		c := d.state[k]
+		if err := visit(c.app, c.instance); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// expired checks if the lease of any tracked instance has expired as of the
+// given time.
+func (d *deltaSource) expired(now time.Time) bool {
+	for _, c := range d.state {
+		if c.instance.LeaseExpired(now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resync retrieves the entire registry and diffs it against the instances
+// known to the watcher.
+func (w *Watcher) resync(d *deltaSource) error {
+	d.state = nil
+
+	state := make(map[string]watched)
+	err := w.update(func(visit InstanceVisitor) error {
+		return d.visit(func(appName string, i *Instance) error {
+			state[key(appName, i)] = watched{appName, i}
+			return visit(appName, i)
+		})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	d.state = state
+	return nil
+}
+
+// apply applies a delta to the tracked state of the registry.
+func (d *deltaSource) apply(delta *AppsResponse) []change {
+	var changes []change
+
+	for _, a := range delta.Apps {
+		for _, i := range a.Instances {
+			c := change{a.Name, key(a.Name, i), i, i.ActionType == ActionDeleted}
+
+			if c.deleted {
+				delete(d.state, c.key)
+			} else {
+				d.state[c.key] = watched{a.Name, i}
+			}
+
+			changes = append(changes, c)
+		}
+	}
+
+	return changes
+}
+
+// updateChanges reports the given changes to instances that satisfy the
+// filters of the watcher.
+func (w *Watcher) updateChanges(changes []change) {
+	type notification struct {
+		app, key string
+		event    Event
+	}
+
+	var notifications []notification
+
+	for _, c := range changes {
+		prev, known := w.instances[c.key]
+		matches := !c.deleted && w.matches(c.app, c.instance)
+
+		var e Event
+		switch {
+		case matches && !known:
+			e = Event{EventInstanceRegistered, c.instance, nil}
+		case matches && !c.instance.Equals(prev.instance):
+			e = Event{w.updateType(prev.instance, c.instance), c.instance, prev.instance}
+		case matches:
+			// e.g. a renewed lease
+			w.instances[c.key] = watched{c.app, c.instance}
+			continue
+		case known:
+			e = Event{EventInstanceDeregistered, prev.instance, nil}
+		default:
+			continue
+		}
+
+		if matches {
+			w.instances[c.key] = watched{c.app, c.instance}
+		} else {
+			delete(w.instances, c.key)
+		}
+
+		notifications = append(notifications, notification{c.app, c.key, e})
+	}
+
+	if len(notifications) == 0 {
+		return
+	}
+
+	w.subMtx.Lock()
+
+	w.mtx.Lock()
+	snapshot := make(map[string][]*Instance, len(w.snapshot))
+	for app, instances := range w.snapshot {
+		snapshot[app] = instances
+	}
+	for _, n := range notifications {
+		snapshot[n.app] = replace(snapshot[n.app], n.app, n.key, n.event)
+		if len(snapshot[n.app]) == 0 {
+			delete(snapshot, n.app)
+		}
+	}
+	w.snapshot = snapshot
+	w.mtx.Unlock()
+
+	subs := w.subs
+	w.subMtx.Unlock()
+
+	for _, n := range notifications {
+		notify(subs, n.app, n.key, n.event)
+	}
+}
+
+// replace returns a copy of the instances of an app with the given event
+// applied to it.
+func replace(instances []*Instance, appName, k string, e Event) []*Instance {
+	result := make([]*Instance, 0, len(instances)+1)
+	for _, i := range instances {
+		if key(appName, i) != k {
+			result = append(result, i)
+		}
+	}
+
+	if e.Type != EventInstanceDeregistered {
+		result = append(result, e.Instance)
+	}
+
+	return result
+}
+
+// hashcode calculates the apps hashcode of the given instances, i.e. the
+// number of instances per status ordered by status, e.g. DOWN_1_UP_3_.
+func hashcode(instances map[string]watched) string {
+	counts := make(map[string]int)
+	for _, i := range instances {
+		counts[i.instance.Status.String()]++
+	}
+
+	statuses := make([]string, 0, len(counts))
+	for s := range counts {
+		statuses = append(statuses, s)
+	}
+	sort.Strings(statuses)
+
+	var buf bytes.Buffer
+	for _, s := range statuses {
+		buf.WriteString(s)
+		buf.WriteByte('_')
+		buf.WriteString(strconv.Itoa(counts[s]))
+		buf.WriteByte('_')
+	}
+
+	return buf.String()
+}
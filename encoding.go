@@ -177,3 +177,64 @@ func (s *Status) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	*s, err = ParseStatus(str)
 	return err
 }
+
+// decodeApps decodes a list of apps from the given reader one element at a
+// time. If visitApp is set, it is called for every application element.
+// Otherwise, visitInstance is called for every instance element without ever
+// holding more than one instance in memory.
+func decodeApps(r io.Reader, visitApp AppVisitor, visitInstance InstanceVisitor) error {
+	var (
+		decoder = xml.NewDecoder(r)
+		inApp   bool
+		appName string
+	)
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if end, ok := token.(xml.EndElement); ok && end.Name.Local == "application" {
+			inApp = false
+			continue
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case start.Name.Local == "application" && visitApp != nil:
+			app := new(App)
+			if err := decoder.DecodeElement(app, &start); err != nil {
+				return err
+			}
+
+			if err := visitApp(app); err != nil {
+				return err
+			}
+		case start.Name.Local == "application":
+			inApp = true
+			appName = ""
+		case start.Name.Local == "name" && inApp:
+			if err := decoder.DecodeElement(&appName, &start); err != nil {
+				return err
+			}
+		case start.Name.Local == "instance" && inApp:
+			instance := new(Instance)
+			if err := decoder.DecodeElement(instance, &start); err != nil {
+				return err
+			}
+
+			if err := visitInstance(appName, instance); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package eureka
+
+import (
+	"os"
+
+	"golang.org/x/net/context"
+)
+
+// ShutdownOnSignals is like ShutdownOnSignal but reads the signals from the
+// given channel instead of the process, which makes it safe to test.
+func ShutdownOnSignals(ctx context.Context, client API, instance *Instance, signals <-chan os.Signal, options ...ShutdownOption) error {
+	return newShutdown(options).onSignal(ctx, client, instance, signals)
+}
+
+// UpdateWatcher applies a single poll of the instances fed by visit to a new
+// watcher configured with the given options, without polling in the
+// background.
+func UpdateWatcher(visit func(InstanceVisitor) error, options ...WatchOption) error {
+	w := &Watcher{synced: make(chan struct{})}
+	for _, opt := range options {
+		opt(w)
+	}
+
+	return w.update(visit)
+}
+
+// VisitRegistry returns the function a watcher uses to read the instances of
+// the given registry.
+func VisitRegistry(registry Registry) func(InstanceVisitor) error {
+	return visitInstances(registry)
+}
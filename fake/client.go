@@ -0,0 +1,85 @@
+package fake
+
+import (
+	"time"
+
+	"github.com/st3v/go-eureka"
+)
+
+var _ eureka.API = new(Client)
+
+// Client is an in-memory implementation of eureka.API. It shares its storage
+// logic with the fake registry and can be used in unit tests that should not
+// depend on a running HTTP server.
+type Client struct {
+	store *store
+}
+
+// NewClient returns an in-memory client backed by an empty registry.
+func NewClient() *Client {
+	return NewRegistry().Client()
+}
+
+func (c *Client) Register(instance *eureka.Instance) error {
+	return c.store.register(instance.AppName, instance)
+}
+
+func (c *Client) Deregister(instance *eureka.Instance) error {
+	return c.store.deregister(instance.AppName, instance.ID)
+}
+
+func (c *Client) Heartbeat(instance *eureka.Instance) error {
+	return c.store.heartbeat(instance.AppName, instance.ID)
+}
+
+// Watch returns a new watcher that keeps polling the in-memory registry at
+// the defined interval and reports observed changes on its Events() channel.
+func (c *Client) Watch(pollInterval time.Duration, options ...eureka.WatchOption) *eureka.Watcher {
+	return eureka.NewWatcher(c, pollInterval, options...)
+}
+
+func (c *Client) Apps() ([]*eureka.App, error) {
+	return c.store.list(), nil
+}
+
+func (c *Client) VisitApps(visit eureka.AppVisitor) error {
+	for _, app := range c.store.list() {
+		if err := visit(app); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) VisitInstances(visit eureka.InstanceVisitor) error {
+	for _, app := range c.store.list() {
+		for _, i := range app.Instances {
+			if err := visit(app.Name, i); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) App(appName string) (*eureka.App, error) {
+	return c.store.app(appName)
+}
+
+func (c *Client) AppInstance(appName, instanceID string) (*eureka.Instance, error) {
+	return c.store.appInstance(appName, instanceID)
+}
+
+func (c *Client) Instance(instanceID string) (*eureka.Instance, error) {
+	return c.store.instance(instanceID)
+}
+
+func (c *Client) StatusOverride(instance *eureka.Instance, status eureka.Status) error {
+	return c.store.statusOverride(instance.AppName, instance.ID, status)
+}
+
+func (c *Client) RemoveStatusOverride(instance *eureka.Instance, fallback eureka.Status) error {
+	return c.store.removeStatusOverride(instance.AppName, instance.ID, fallback)
+}
@@ -0,0 +1,128 @@
+package fake_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/go-eureka"
+	"github.com/st3v/go-eureka/fake"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		client   *fake.Client
+		instance *eureka.Instance
+	)
+
+	BeforeEach(func() {
+		client = fake.NewClient()
+		instance = &eureka.Instance{
+			ID:       "one",
+			AppName:  "app",
+			HostName: "one.example.com",
+			Status:   eureka.StatusUp,
+			Metadata: eureka.Metadata{"key": "value"},
+		}
+
+		Expect(client.Register(instance)).To(Succeed())
+	})
+
+	It("refuses to register the same instance twice", func() {
+		Expect(client.Register(instance)).To(MatchError(fake.ErrInstanceRegistered))
+	})
+
+	It("returns registered apps", func() {
+		apps, err := client.Apps()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(apps).To(HaveLen(1))
+		Expect(apps[0].Name).To(Equal("app"))
+		Expect(apps[0].Instances).To(ConsistOf(instance))
+	})
+
+	It("returns a registered app by name", func() {
+		app, err := client.App("app")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(app.Instances).To(ConsistOf(instance))
+
+		_, err = client.App("unknown")
+		Expect(err).To(MatchError(fake.ErrAppNotFound))
+		Expect(errors.Is(err, eureka.ErrNotFound)).To(BeTrue())
+	})
+
+	It("returns registered instances by id", func() {
+		actual, err := client.AppInstance("app", "one")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(Equal(instance))
+
+		actual, err = client.Instance("one")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(Equal(instance))
+
+		_, err = client.Instance("unknown")
+		Expect(err).To(MatchError(fake.ErrInstanceNotFound))
+	})
+
+	It("returns copies of the stored instances", func() {
+		actual, err := client.Instance("one")
+		Expect(err).ToNot(HaveOccurred())
+
+		actual.Metadata["key"] = "changed"
+
+		actual, err = client.Instance("one")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual.Metadata["key"]).To(Equal("value"))
+	})
+
+	It("accepts heartbeats for registered instances only", func() {
+		Expect(client.Heartbeat(instance)).To(Succeed())
+		Expect(client.Heartbeat(&eureka.Instance{ID: "two", AppName: "app"})).To(MatchError(fake.ErrInstanceNotFound))
+	})
+
+	It("overrides and restores the status of an instance", func() {
+		Expect(client.StatusOverride(instance, eureka.StatusOutOfService)).To(Succeed())
+
+		actual, _ := client.Instance("one")
+		Expect(actual.Status).To(Equal(eureka.StatusOutOfService))
+		Expect(actual.StatusOverride).To(Equal(eureka.StatusOutOfService))
+
+		Expect(client.RemoveStatusOverride(instance, eureka.StatusUp)).To(Succeed())
+
+		actual, _ = client.Instance("one")
+		Expect(actual.Status).To(Equal(eureka.StatusUp))
+		Expect(actual.StatusOverride).To(Equal(eureka.StatusUnknown))
+	})
+
+	It("deregisters instances", func() {
+		Expect(client.Deregister(instance)).To(Succeed())
+		Expect(client.Deregister(instance)).To(MatchError(fake.ErrInstanceNotFound))
+
+		apps, err := client.Apps()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(apps).To(BeEmpty())
+	})
+
+	It("returns a functional watcher", func() {
+		watcher := client.Watch(10 * time.Millisecond)
+		defer watcher.Stop()
+
+		Eventually(watcher.Events()).Should(Receive(Equal(eureka.Event{Type: eureka.EventInstanceRegistered, Instance: instance})))
+
+		Expect(client.Deregister(instance)).To(Succeed())
+
+		Eventually(watcher.Events()).Should(Receive(Equal(eureka.Event{Type: eureka.EventInstanceDeregistered, Instance: instance})))
+	})
+
+	It("shares its storage with the registry it was obtained from", func() {
+		registry := fake.NewRegistry()
+		a, b := registry.Client(), registry.Client()
+
+		Expect(a.Register(instance)).To(Succeed())
+
+		actual, err := b.Instance("one")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(actual).To(Equal(instance))
+	})
+})
@@ -2,8 +2,12 @@ package fake
 
 import (
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/emicklei/go-restful"
 
@@ -11,15 +15,38 @@ import (
 )
 
 type registry struct {
-	apps map[string]*eureka.App
+	store *store
+
+	mtx         sync.Mutex
+	unavailable int
+	retryAfter  time.Duration
 }
 
 func NewRegistry() *registry {
 	return &registry{
-		apps: map[string]*eureka.App{},
+		store: newStore(),
 	}
 }
 
+// Client returns an in-memory client that operates directly on the apps held
+// by this registry, i.e. without going through HTTP.
+func (r *registry) Client() *Client {
+	return &Client{
+		store: r.store,
+	}
+}
+
+// Unavailable makes the registry respond to the next n requests with status
+// 503, like an overloaded Eureka server or one that is still starting up. If
+// retryAfter is positive, it is sent to clients using the Retry-After header.
+func (r *registry) Unavailable(n int, retryAfter time.Duration) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.unavailable = n
+	r.retryAfter = retryAfter
+}
+
 func (r *registry) HTTPServer(addr string, debug bool) *http.Server {
 	if debug {
 		restful.TraceLogger(log.New(os.Stdout, "[restful] ", log.LstdFlags|log.Lshortfile))
@@ -28,6 +55,7 @@ func (r *registry) HTTPServer(addr string, debug bool) *http.Server {
 	s := new(restful.WebService)
 
 	s.Path("/").Produces(restful.MIME_XML)
+	s.Filter(r.fault)
 	s.Route(s.POST("/apps/{app-name}").To(r.register).Consumes(restful.MIME_XML))
 	s.Route(s.DELETE("/apps/{app-name}/{instance-id}").To(r.deregister))
 	s.Route(s.PUT("/apps/{app-name}/{instance-id}").To(r.heartbeat))
@@ -38,10 +66,37 @@ func (r *registry) HTTPServer(addr string, debug bool) *http.Server {
 	s.Route(s.DELETE("/apps/{app-name}/{instance-id}/status").To(r.removeStatusOverride))
 	s.Route(s.GET("/instances/{instance-id}").To(r.instance))
 
+	container := restful.NewContainer()
+	container.EnableContentEncoding(true)
+	container.Add(s)
+
 	return &http.Server{
 		Addr:    addr,
-		Handler: restful.NewContainer().Add(s),
+		Handler: container,
+	}
+}
+
+func (r *registry) fault(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	r.mtx.Lock()
+	unavailable := r.unavailable > 0
+	if unavailable {
+		r.unavailable--
+	}
+	retryAfter := r.retryAfter
+	r.mtx.Unlock()
+
+	if !unavailable {
+		chain.ProcessFilter(req, resp)
+		return
+	}
+
+	if retryAfter > 0 {
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		resp.AddHeader("Retry-After", strconv.Itoa(seconds))
 	}
+
+	resp.AddHeader("Content-Type", "text/plain")
+	resp.WriteErrorString(http.StatusServiceUnavailable, "Service unavailable.")
 }
 
 func (r *registry) deregister(req *restful.Request, resp *restful.Response) {
@@ -50,22 +105,12 @@ func (r *registry) deregister(req *restful.Request, resp *restful.Response) {
 	name := req.PathParameter("app-name")
 	instanceID := req.PathParameter("instance-id")
 
-	if app, found := r.apps[name]; found {
-		for i, instance := range app.Instances {
-			if instance.ID == instanceID {
-				app.Instances = append(app.Instances[0:i], app.Instances[i+1:]...)
-
-				if len(app.Instances) == 0 {
-					delete(r.apps, name)
-				}
-
-				resp.WriteHeader(http.StatusOK)
-				return
-			}
-		}
+	if err := r.store.deregister(name, instanceID); err != nil {
+		resp.WriteErrorString(http.StatusNotFound, err.Error())
+		return
 	}
 
-	resp.WriteErrorString(http.StatusNotFound, "Instance not found.")
+	resp.WriteHeader(http.StatusOK)
 }
 
 func (r *registry) register(req *restful.Request, resp *restful.Response) {
@@ -80,36 +125,17 @@ func (r *registry) register(req *restful.Request, resp *restful.Response) {
 		return
 	}
 
-	app, found := r.apps[name]
-	if !found {
-		app = &eureka.App{
-			Name:      name,
-			Instances: make([]*eureka.Instance, 0, 1),
-		}
-	}
-
-	for _, i := range app.Instances {
-		if i.ID == instance.ID {
-			resp.WriteErrorString(http.StatusMethodNotAllowed, "Instance already registered")
-			return
-		}
+	if err := r.store.register(name, instance); err != nil {
+		resp.WriteErrorString(http.StatusMethodNotAllowed, err.Error())
+		return
 	}
 
-	app.Instances = append(app.Instances, instance)
-
-	r.apps[name] = app
 	resp.WriteHeader(http.StatusNoContent)
 }
 
 func (r *registry) list(req *restful.Request, resp *restful.Response) {
-	apps := make([]*eureka.App, 0, len(r.apps))
-
-	for _, app := range r.apps {
-		apps = append(apps, app)
-	}
-
 	result := eureka.AppsResponse{
-		Apps: apps,
+		Apps: r.store.list(),
 	}
 
 	resp.WriteEntity(result)
@@ -118,10 +144,10 @@ func (r *registry) list(req *restful.Request, resp *restful.Response) {
 func (r *registry) app(req *restful.Request, resp *restful.Response) {
 	name := req.PathParameter("app-name")
 
-	app, found := r.apps[name]
-	if !found {
+	app, err := r.store.app(name)
+	if err != nil {
 		resp.AddHeader("Content-Type", "text/plain")
-		resp.WriteErrorString(http.StatusNotFound, "App not found.")
+		resp.WriteErrorString(http.StatusNotFound, err.Error())
 		return
 	}
 
@@ -134,8 +160,8 @@ func (r *registry) heartbeat(req *restful.Request, resp *restful.Response) {
 	name := req.PathParameter("app-name")
 	instanceID := req.PathParameter("instance-id")
 
-	if _, found := r.findAppInstance(name, instanceID); !found {
-		resp.WriteErrorString(http.StatusNotFound, "Instance not found.")
+	if err := r.store.heartbeat(name, instanceID); err != nil {
+		resp.WriteErrorString(http.StatusNotFound, err.Error())
 		return
 	}
 
@@ -145,26 +171,26 @@ func (r *registry) heartbeat(req *restful.Request, resp *restful.Response) {
 func (r *registry) instance(req *restful.Request, resp *restful.Response) {
 	instanceID := req.PathParameter("instance-id")
 
-	if i, found := findInstance(instanceID, r.apps); found {
+	if i, err := r.store.instance(instanceID); err == nil {
 		resp.WriteEntity(i)
 		return
 	}
 
 	resp.AddHeader("Content-Type", "text/plain")
-	resp.WriteErrorString(http.StatusNotFound, "Instance not found.")
+	resp.WriteErrorString(http.StatusNotFound, ErrInstanceNotFound.Error())
 }
 
 func (r *registry) appInstance(req *restful.Request, resp *restful.Response) {
 	name := req.PathParameter("app-name")
 	instanceID := req.PathParameter("instance-id")
 
-	if i, found := r.findAppInstance(name, instanceID); found {
+	if i, err := r.store.appInstance(name, instanceID); err == nil {
 		resp.WriteEntity(i)
 		return
 	}
 
 	resp.AddHeader("Content-Type", "text/plain")
-	resp.WriteErrorString(http.StatusNotFound, "Instance not found.")
+	resp.WriteErrorString(http.StatusNotFound, ErrInstanceNotFound.Error())
 }
 
 func (r *registry) statusOverride(req *restful.Request, resp *restful.Response) {
@@ -178,14 +204,10 @@ func (r *registry) statusOverride(req *restful.Request, resp *restful.Response)
 	name := req.PathParameter("app-name")
 	instanceID := req.PathParameter("instance-id")
 
-	instance, found := r.findAppInstance(name, instanceID)
-	if !found {
+	if err := r.store.statusOverride(name, instanceID, status); err != nil {
 		resp.WriteErrorString(http.StatusNotFound, "Instance not registered")
 		return
 	}
-
-	instance.Status = status
-	instance.StatusOverride = status
 }
 
 func (r *registry) removeStatusOverride(req *restful.Request, resp *restful.Response) {
@@ -200,32 +222,8 @@ func (r *registry) removeStatusOverride(req *restful.Request, resp *restful.Resp
 	name := req.PathParameter("app-name")
 	instanceID := req.PathParameter("instance-id")
 
-	instance, found := r.findAppInstance(name, instanceID)
-	if !found {
+	if err := r.store.removeStatusOverride(name, instanceID, status); err != nil {
 		resp.WriteErrorString(http.StatusNotFound, "Instance not registered")
 		return
 	}
-
-	instance.Status = status
-	instance.StatusOverride = eureka.StatusUnknown
-}
-
-func (r *registry) findAppInstance(appName, instanceID string) (*eureka.Instance, bool) {
-	if app, found := r.apps[appName]; found {
-		return findInstance(instanceID, map[string]*eureka.App{app.Name: app})
-	}
-
-	return nil, false
-}
-
-func findInstance(instanceID string, apps map[string]*eureka.App) (*eureka.Instance, bool) {
-	for _, a := range apps {
-		for _, i := range a.Instances {
-			if i.ID == instanceID {
-				return i, true
-			}
-		}
-	}
-
-	return nil, false
 }
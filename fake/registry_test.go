@@ -0,0 +1,71 @@
+package fake_test
+
+import (
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/go-eureka"
+	"github.com/st3v/go-eureka/fake"
+	"github.com/st3v/go-eureka/retry"
+)
+
+var _ = Describe("registry", func() {
+	var (
+		registry = fake.NewRegistry()
+		server   *httptest.Server
+		client   *eureka.Client
+	)
+
+	BeforeEach(func() {
+		registry = fake.NewRegistry()
+		server = httptest.NewServer(registry.HTTPServer("", false).Handler)
+		client = eureka.NewClient(
+			[]string{server.URL},
+			eureka.RetryLimit(retry.MaxRetries(3)),
+			eureka.RetryDelay(retry.NoDelay()),
+			eureka.MaxRetryAfter(20*time.Millisecond),
+		)
+
+		instance := &eureka.Instance{
+			ID:      "one",
+			AppName: "app",
+			Status:  eureka.StatusUp,
+		}
+		Expect(client.Register(instance)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("serves registered apps", func() {
+		apps, err := client.Apps()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(apps).To(HaveLen(1))
+		Expect(apps[0].Instances).To(HaveLen(1))
+		Expect(apps[0].Instances[0].ID).To(Equal("one"))
+	})
+
+	Describe(".Unavailable", func() {
+		It("fails the given number of requests asking clients to retry later", func() {
+			registry.Unavailable(2, time.Second)
+
+			start := time.Now()
+			apps, err := client.Apps()
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(apps).To(HaveLen(1))
+			Expect(time.Since(start)).To(BeNumerically(">=", 40*time.Millisecond))
+		})
+
+		It("returns status 503 to clients running out of retries", func() {
+			registry.Unavailable(3, 0)
+
+			_, err := client.Apps()
+			Expect(err).To(MatchError("Unexpected response code 503 (3 attempts)"))
+		})
+	})
+})
@@ -0,0 +1,217 @@
+package fake
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/st3v/go-eureka"
+)
+
+var (
+	// ErrAppNotFound is returned when a requested app is not registered. It
+	// matches eureka.ErrNotFound.
+	ErrAppNotFound error = notFoundError("App not found.")
+
+	// ErrInstanceNotFound is returned when a requested instance is not
+	// registered. It matches eureka.ErrNotFound.
+	ErrInstanceNotFound error = notFoundError("Instance not found.")
+
+	// ErrInstanceRegistered is returned when registering an instance that is
+	// already registered.
+	ErrInstanceRegistered = errors.New("Instance already registered")
+)
+
+type notFoundError string
+
+func (e notFoundError) Error() string {
+	return string(e)
+}
+
+func (e notFoundError) Is(target error) bool {
+	return target == eureka.ErrNotFound
+}
+
+// store holds the registered apps and is shared by the HTTP registry and the
+// in-memory client. All values handed out by the store are copies.
+type store struct {
+	mtx  sync.RWMutex
+	apps map[string]*eureka.App
+}
+
+func newStore() *store {
+	return &store{
+		apps: map[string]*eureka.App{},
+	}
+}
+
+func (s *store) register(appName string, instance *eureka.Instance) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	app, found := s.apps[appName]
+	if !found {
+		app = &eureka.App{
+			Name:      appName,
+			Instances: make([]*eureka.Instance, 0, 1),
+		}
+	}
+
+	for _, i := range app.Instances {
+		if i.ID == instance.ID {
+			return ErrInstanceRegistered
+		}
+	}
+
+	app.Instances = append(app.Instances, copyInstance(instance))
+
+	s.apps[appName] = app
+	return nil
+}
+
+func (s *store) deregister(appName, instanceID string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if app, found := s.apps[appName]; found {
+		for i, instance := range app.Instances {
+			if instance.ID == instanceID {
+				app.Instances = append(app.Instances[0:i], app.Instances[i+1:]...)
+
+				if len(app.Instances) == 0 {
+					delete(s.apps, appName)
+				}
+
+				return nil
+			}
+		}
+	}
+
+	return ErrInstanceNotFound
+}
+
+func (s *store) heartbeat(appName, instanceID string) error {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if _, found := s.findAppInstance(appName, instanceID); !found {
+		return ErrInstanceNotFound
+	}
+
+	return nil
+}
+
+func (s *store) list() []*eureka.App {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	apps := make([]*eureka.App, 0, len(s.apps))
+	for _, app := range s.apps {
+		apps = append(apps, copyApp(app))
+	}
+
+	return apps
+}
+
+func (s *store) app(appName string) (*eureka.App, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	app, found := s.apps[appName]
+	if !found {
+		return nil, ErrAppNotFound
+	}
+
+	return copyApp(app), nil
+}
+
+func (s *store) appInstance(appName, instanceID string) (*eureka.Instance, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if i, found := s.findAppInstance(appName, instanceID); found {
+		return copyInstance(i), nil
+	}
+
+	return nil, ErrInstanceNotFound
+}
+
+func (s *store) instance(instanceID string) (*eureka.Instance, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if i, found := findInstance(instanceID, s.apps); found {
+		return copyInstance(i), nil
+	}
+
+	return nil, ErrInstanceNotFound
+}
+
+func (s *store) statusOverride(appName, instanceID string, status eureka.Status) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	instance, found := s.findAppInstance(appName, instanceID)
+	if !found {
+		return ErrInstanceNotFound
+	}
+
+	instance.Status = status
+	instance.StatusOverride = status
+
+	return nil
+}
+
+func (s *store) removeStatusOverride(appName, instanceID string, fallback eureka.Status) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	instance, found := s.findAppInstance(appName, instanceID)
+	if !found {
+		return ErrInstanceNotFound
+	}
+
+	instance.Status = fallback
+	instance.StatusOverride = eureka.StatusUnknown
+
+	return nil
+}
+
+func (s *store) findAppInstance(appName, instanceID string) (*eureka.Instance, bool) {
+	if app, found := s.apps[appName]; found {
+		return findInstance(instanceID, map[string]*eureka.App{app.Name: app})
+	}
+
+	return nil, false
+}
+
+func findInstance(instanceID string, apps map[string]*eureka.App) (*eureka.Instance, bool) {
+	for _, a := range apps {
+		for _, i := range a.Instances {
+			if i.ID == instanceID {
+				return i, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func copyApp(app *eureka.App) *eureka.App {
+	c := *app
+	c.Instances = make([]*eureka.Instance, 0, len(app.Instances))
+	for _, i := range app.Instances {
+		c.Instances = append(c.Instances, copyInstance(i))
+	}
+	return &c
+}
+
+func copyInstance(instance *eureka.Instance) *eureka.Instance {
+	c := *instance
+	if instance.Metadata != nil {
+		c.Metadata = make(eureka.Metadata, len(instance.Metadata))
+		for k, v := range instance.Metadata {
+			c.Metadata[k] = v
+		}
+	}
+	return &c
+}
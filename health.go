@@ -0,0 +1,229 @@
+package eureka
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// DefaultHealthRise defines how many consecutive healthy results are
+	// required before an instance is reported UP again.
+	DefaultHealthRise = 2
+
+	// DefaultHealthFall defines how many consecutive unhealthy results are
+	// required before an instance is reported DOWN or OUT_OF_SERVICE.
+	DefaultHealthFall = 3
+)
+
+// HealthCheck determines the status of the local instance. Only StatusUp,
+// StatusDown and StatusOutOfService are reported to the registry, any other
+// status is treated as StatusDown.
+type HealthCheck func(ctx context.Context) Status
+
+// HTTPHealthCheck returns a check that probes the given URL, e.g. the
+// HealthCheckURL of an instance. Responses with a 2xx or 3xx status code
+// indicate that the instance is up, everything else that it is down. Probes
+// time out after the given duration.
+func HTTPHealthCheck(url string, timeout time.Duration) HealthCheck {
+	client := &http.Client{Timeout: timeout}
+
+	return func(ctx context.Context) Status {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return StatusDown
+		}
+
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return StatusDown
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			return StatusDown
+		}
+
+		return StatusUp
+	}
+}
+
+// HealthReporter runs a health check for a registered instance at a fixed
+// interval and reports changes of its status to the registry. Unhealthy
+// instances are reported by overriding their status, the override is removed
+// once they are healthy again. To prevent flapping, a new status is only
+// reported after the check returned it a number of times in a row.
+type HealthReporter struct {
+	client   API
+	instance *Instance
+	check    HealthCheck
+	rise     int
+	fall     int
+	onError  func(error)
+	onChange func(Status)
+
+	mtx       sync.RWMutex
+	status    Status
+	candidate Status
+	count     int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// HealthOption configures a HealthReporter.
+type HealthOption func(*HealthReporter)
+
+// HealthThresholds defines how many consecutive results are required before
+// an instance is reported UP again (rise) or reported as unhealthy (fall).
+// Values below 1 are treated as 1.
+func HealthThresholds(rise, fall int) HealthOption {
+	return func(r *HealthReporter) {
+		r.rise = rise
+		r.fall = fall
+	}
+}
+
+// HealthErrorHandler registers a handler that is called whenever a status
+// cannot be reported to the registry. Failed reports are repeated after the
+// next check.
+func HealthErrorHandler(handler func(error)) HealthOption {
+	return func(r *HealthReporter) {
+		r.onError = handler
+	}
+}
+
+// HealthChangeHandler registers a handler that is called whenever a new
+// status has been reported to the registry.
+func HealthChangeHandler(handler func(Status)) HealthOption {
+	return func(r *HealthReporter) {
+		r.onChange = handler
+	}
+}
+
+// NewHealthReporter starts checking the health of the given instance at the
+// defined interval. The status the instance has been registered with is
+// assumed to be the currently reported one. Call Stop to stop checking.
+func NewHealthReporter(client API, instance *Instance, check HealthCheck, interval time.Duration, options ...HealthOption) *HealthReporter {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r := &HealthReporter{
+		client:   client,
+		instance: instance,
+		check:    check,
+		rise:     DefaultHealthRise,
+		fall:     DefaultHealthFall,
+		onError:  func(error) {},
+		onChange: func(Status) {},
+		status:   instance.Status,
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+
+	for _, opt := range options {
+		opt(r)
+	}
+
+	r.candidate = r.status
+
+	go r.run(interval)
+
+	return r
+}
+
+// Stop stops checking the health of the instance. The last reported status
+// stays in place.
+func (r *HealthReporter) Stop() {
+	r.cancel()
+	<-r.done
+}
+
+// Status returns the status that has last been reported to the registry.
+func (r *HealthReporter) Status() Status {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	return r.status
+}
+
+func (r *HealthReporter) run(interval time.Duration) {
+	defer close(r.done)
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-tick.C:
+			r.observe(reportable(r.check(r.ctx)))
+		}
+	}
+}
+
+// observe records the result of a check and reports the result once it has
+// been observed often enough in a row.
+func (r *HealthReporter) observe(status Status) {
+	if r.ctx.Err() != nil {
+		return
+	}
+
+	r.mtx.Lock()
+	current := r.status
+
+	switch {
+	case status == current:
+		r.candidate, r.count = current, 0
+	case status == r.candidate:
+		r.count++
+	default:
+		r.candidate, r.count = status, 1
+	}
+
+	threshold := r.fall
+	if status == StatusUp {
+		threshold = r.rise
+	}
+
+	report := status != current && r.count >= threshold
+	r.mtx.Unlock()
+
+	if !report {
+		return
+	}
+
+	if err := r.report(status); err != nil {
+		r.onError(err)
+		return
+	}
+
+	r.mtx.Lock()
+	r.status, r.candidate, r.count = status, status, 0
+	r.mtx.Unlock()
+
+	r.onChange(status)
+}
+
+func (r *HealthReporter) report(status Status) error {
+	if status == StatusUp {
+		return r.client.RemoveStatusOverride(r.instance, StatusUp)
+	}
+
+	return r.client.StatusOverride(r.instance, status)
+}
+
+// reportable maps a status to one of the statuses reported by a
+// HealthReporter.
+func reportable(status Status) Status {
+	switch status {
+	case StatusUp, StatusOutOfService:
+		return status
+	}
+
+	return StatusDown
+}
@@ -0,0 +1,202 @@
+package eureka_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"golang.org/x/net/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/go-eureka"
+	"github.com/st3v/go-eureka/fake"
+)
+
+var _ = Describe("HealthReporter", func() {
+	var (
+		interval = time.Millisecond
+
+		client   *fake.Client
+		instance *eureka.Instance
+		results  chan eureka.Status
+		changes  chan eureka.Status
+		reporter *eureka.HealthReporter
+	)
+
+	// check returns the results sent by the test, one per call.
+	check := func(ctx context.Context) eureka.Status {
+		select {
+		case s := <-results:
+			return s
+		case <-ctx.Done():
+			return eureka.StatusUnknown
+		}
+	}
+
+	report := func(statuses ...eureka.Status) {
+		for _, s := range statuses {
+			results <- s
+		}
+	}
+
+	registered := func() eureka.Status {
+		i, err := client.AppInstance(instance.AppName, instance.ID)
+		Expect(err).ToNot(HaveOccurred())
+		return i.Status
+	}
+
+	start := func(options ...eureka.HealthOption) {
+		options = append(options, eureka.HealthChangeHandler(func(s eureka.Status) {
+			changes <- s
+		}))
+		reporter = eureka.NewHealthReporter(client, instance, check, interval, options...)
+	}
+
+	BeforeEach(func() {
+		client = fake.NewClient()
+		instance = &eureka.Instance{
+			ID:      "one",
+			AppName: "app",
+			Status:  eureka.StatusUp,
+		}
+		Expect(client.Register(instance)).To(Succeed())
+
+		results = make(chan eureka.Status)
+		changes = make(chan eureka.Status, 10)
+	})
+
+	AfterEach(func() {
+		reporter.Stop()
+	})
+
+	It("reports unhealthy instances after the fall threshold", func() {
+		start(eureka.HealthThresholds(2, 3))
+
+		report(eureka.StatusDown, eureka.StatusDown)
+		Consistently(changes).ShouldNot(Receive())
+		Expect(registered()).To(Equal(eureka.StatusUp))
+
+		report(eureka.StatusDown)
+		Eventually(changes).Should(Receive(Equal(eureka.StatusDown)))
+		Expect(registered()).To(Equal(eureka.StatusDown))
+		Expect(reporter.Status()).To(Equal(eureka.StatusDown))
+	})
+
+	It("reports healthy instances after the rise threshold", func() {
+		start(eureka.HealthThresholds(2, 1))
+
+		report(eureka.StatusOutOfService)
+		Eventually(changes).Should(Receive(Equal(eureka.StatusOutOfService)))
+		Expect(registered()).To(Equal(eureka.StatusOutOfService))
+
+		report(eureka.StatusUp)
+		Consistently(changes).ShouldNot(Receive())
+
+		report(eureka.StatusUp)
+		Eventually(changes).Should(Receive(Equal(eureka.StatusUp)))
+
+		i, err := client.AppInstance(instance.AppName, instance.ID)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(i.Status).To(Equal(eureka.StatusUp))
+		Expect(i.StatusOverride).To(Equal(eureka.StatusUnknown))
+	})
+
+	It("ignores results that do not persist", func() {
+		start(eureka.HealthThresholds(2, 2))
+
+		report(eureka.StatusDown, eureka.StatusUp, eureka.StatusDown, eureka.StatusOutOfService, eureka.StatusUp)
+		Consistently(changes).ShouldNot(Receive())
+		Expect(registered()).To(Equal(eureka.StatusUp))
+	})
+
+	It("reports instances that have been registered as starting once they are up", func() {
+		Expect(client.Deregister(instance)).To(Succeed())
+		instance.Status = eureka.StatusStarting
+		Expect(client.Register(instance)).To(Succeed())
+
+		start(eureka.HealthThresholds(1, 1))
+
+		report(eureka.StatusUp)
+		Eventually(changes).Should(Receive(Equal(eureka.StatusUp)))
+		Expect(registered()).To(Equal(eureka.StatusUp))
+	})
+
+	It("treats other statuses as down", func() {
+		start(eureka.HealthThresholds(1, 1))
+
+		report(eureka.StatusUnknown)
+		Eventually(changes).Should(Receive(Equal(eureka.StatusDown)))
+	})
+
+	It("repeats failed reports", func() {
+		errs := make(chan error, 10)
+		start(eureka.HealthThresholds(1, 1), eureka.HealthErrorHandler(func(err error) {
+			errs <- err
+		}))
+
+		Expect(client.Deregister(instance)).To(Succeed())
+
+		report(eureka.StatusDown)
+		Eventually(errs).Should(Receive(MatchError(fake.ErrInstanceNotFound)))
+		Expect(reporter.Status()).To(Equal(eureka.StatusUp))
+
+		Expect(client.Register(instance)).To(Succeed())
+
+		report(eureka.StatusDown)
+		Eventually(changes).Should(Receive(Equal(eureka.StatusDown)))
+		Expect(registered()).To(Equal(eureka.StatusDown))
+	})
+})
+
+var _ = Describe("HTTPHealthCheck", func() {
+	var servers []*httptest.Server
+
+	serve := func(handler http.HandlerFunc) string {
+		server := httptest.NewServer(handler)
+		servers = append(servers, server)
+		return server.URL
+	}
+
+	respond := func(code int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}
+	}
+
+	AfterEach(func() {
+		for _, s := range servers {
+			s.Close()
+		}
+		servers = nil
+	})
+
+	It("reports successful responses as up", func() {
+		check := eureka.HTTPHealthCheck(serve(respond(http.StatusOK)), time.Second)
+		Expect(check(context.Background())).To(Equal(eureka.StatusUp))
+	})
+
+	It("reports failed responses as down", func() {
+		check := eureka.HTTPHealthCheck(serve(respond(http.StatusServiceUnavailable)), time.Second)
+		Expect(check(context.Background())).To(Equal(eureka.StatusDown))
+	})
+
+	It("reports unreachable endpoints as down", func() {
+		server := httptest.NewServer(respond(http.StatusOK))
+		server.Close()
+
+		check := eureka.HTTPHealthCheck(server.URL, time.Second)
+		Expect(check(context.Background())).To(Equal(eureka.StatusDown))
+	})
+
+	It("times out", func() {
+		block := make(chan struct{})
+		defer close(block)
+
+		check := eureka.HTTPHealthCheck(serve(func(w http.ResponseWriter, r *http.Request) {
+			<-block
+		}), 10*time.Millisecond)
+		Expect(check(context.Background())).To(Equal(eureka.StatusDown))
+	})
+})
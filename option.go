@@ -36,6 +36,10 @@ var (
 
 	// DefaultTimeout defines the default timeout used by the internal http client.
 	DefaultTimeout = 10 * time.Second
+
+	// DefaultMaxRetryAfter defines the default upper bound for delays requested
+	// by the server using the Retry-After header.
+	DefaultMaxRetryAfter = 30 * time.Second
 )
 
 // Option can be used to configure a Client.
@@ -62,6 +66,14 @@ func TLSConfig(config *tls.Config) Option {
 	}
 }
 
+// Gzip instructs the client whether or not to request gzip compressed
+// responses from the Eureka server. Compression is enabled by default.
+func Gzip(enabled bool) Option {
+	return func(c *Client) {
+		c.gzip = enabled
+	}
+}
+
 // Oauth2ClientCredentials instructs the internal http client to use the
 // Oauth2 Client Credential flow to authenticate with the Eureka server.
 func Oauth2ClientCredentials(clientID, clientSecret, tokenURI string, scopes ...string) Option {
@@ -79,6 +91,16 @@ func Oauth2ClientCredentials(clientID, clientSecret, tokenURI string, scopes ...
 func RetryLimit(limit retry.Allow) Option {
 	return func(c *Client) {
 		c.retryLimit = limit
+		c.statefulLimit = nil
+	}
+}
+
+// StatefulRetryLimit instructs the client to limit retries to a given
+// allowance that depends on the state of the retries, e.g. the time elapsed.
+// It replaces any limit set by RetryLimit.
+func StatefulRetryLimit(limit retry.StatefulAllow) Option {
+	return func(c *Client) {
+		c.statefulLimit = limit
 	}
 }
 
@@ -87,12 +109,52 @@ func RetryLimit(limit retry.Allow) Option {
 func RetrySelector(selector retry.Selector) Option {
 	return func(c *Client) {
 		c.retrySelector = selector
+		c.retryFeedback = nil
+	}
+}
+
+// AdaptiveRetrySelector instructs the client to use a selector that learns
+// from the latency and errors observed for each endpoint, e.g. a
+// retry.LatencySelector. The client reports the outcome of every attempt to
+// the selector.
+func AdaptiveRetrySelector(selector retry.AdaptiveSelector) Option {
+	return func(c *Client) {
+		c.retrySelector = selector.Select
+		c.retryFeedback = selector
 	}
 }
 
-// RetryDelay sets the delau the client in-between request retries.
+// RetryObserver installs an observer that is notified before and after every
+// attempt the client makes, e.g. to log or count retries. It can be used
+// multiple times to install more than one observer.
+func RetryObserver(observer retry.Observer) Option {
+	return func(c *Client) {
+		c.observers = append(c.observers, observer)
+	}
+}
+
+// RetryDelay sets the delay the client in-between request retries.
 func RetryDelay(delay retry.Delay) Option {
 	return func(c *Client) {
 		c.retryDelay = delay
+		c.statefulDelay = nil
+	}
+}
+
+// StatefulRetryDelay sets a delay in-between request retries that depends on
+// the state of the retries, e.g. the error returned by the previous attempt.
+// It replaces any delay set by RetryDelay.
+func StatefulRetryDelay(delay retry.StatefulDelay) Option {
+	return func(c *Client) {
+		c.statefulDelay = delay
+	}
+}
+
+// MaxRetryAfter sets the upper bound for delays requested by the server using
+// the Retry-After header. The header is ignored if max is 0. The delay only
+// applies to retries against the server that requested it.
+func MaxRetryAfter(max time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetryAfter = max
 	}
 }
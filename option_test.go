@@ -36,6 +36,16 @@ var _ = Describe("client options", func() {
 			Expect(reflect.ValueOf(client.retryLimit)).To(Equal(reflect.ValueOf(DefaultRetryLimit)))
 		})
 
+		It("requests gzip compressed responses", func() {
+			client := NewClient([]string{"endpoint"})
+			Expect(client.gzip).To(BeTrue())
+		})
+
+		It("uses the default upper bound for Retry-After delays", func() {
+			client := NewClient([]string{"endpoint"})
+			Expect(client.maxRetryAfter).To(Equal(DefaultMaxRetryAfter))
+		})
+
 		It("uses the default retry delay", func() {
 			client := NewClient([]string{"endpoint"})
 			Expect(reflect.ValueOf(client.retryDelay)).To(Equal(reflect.ValueOf(DefaultRetryDelay)))
@@ -68,6 +78,20 @@ var _ = Describe("client options", func() {
 		})
 	})
 
+	Describe("Gzip", func() {
+		It("disables gzip compression", func() {
+			client := NewClient([]string{"endpoint"}, Gzip(false))
+			Expect(client.gzip).To(BeFalse())
+		})
+	})
+
+	Describe("MaxRetryAfter", func() {
+		It("sets the upper bound for Retry-After delays", func() {
+			client := NewClient([]string{"endpoint"}, MaxRetryAfter(time.Minute))
+			Expect(client.maxRetryAfter).To(Equal(time.Minute))
+		})
+	})
+
 	Describe("Oauth2ClientCredentials", func() {
 		It("wraps the internal http client transport in an oauth2 transport", func() {
 			id, secret, uri, scope := "client-id", "client-secret", "token-uri", "scope"
@@ -89,6 +113,21 @@ var _ = Describe("client options", func() {
 		})
 	})
 
+	Describe("AdaptiveRetrySelector", func() {
+		It("uses the selector and reports attempts to it", func() {
+			selector := retry.NewLatencySelector(retry.DefaultLatencyDecay, retry.DefaultExploration, nil)
+			client := NewClient([]string{"endpoint"}, AdaptiveRetrySelector(selector))
+			Expect(client.retryFeedback).To(BeIdenticalTo(selector))
+			Expect(client.retrySelector).ToNot(BeNil())
+		})
+
+		It("is replaced by RetrySelector", func() {
+			selector := retry.NewLatencySelector(retry.DefaultLatencyDecay, retry.DefaultExploration, nil)
+			client := NewClient([]string{"endpoint"}, AdaptiveRetrySelector(selector), RetrySelector(retry.RoundRobin))
+			Expect(client.retryFeedback).To(BeNil())
+		})
+	})
+
 	Describe("RetryLimit", func() {
 		var allow retry.Allow = func(_ uint) bool { return true }
 
@@ -98,6 +137,44 @@ var _ = Describe("client options", func() {
 		})
 	})
 
+	Describe("StatefulRetryLimit", func() {
+		var allow retry.StatefulAllow = func(_ retry.State) bool { return true }
+
+		It("sets a stateful retry limit", func() {
+			client := NewClient([]string{"endpoint"}, StatefulRetryLimit(allow))
+			Expect(reflect.ValueOf(client.statefulLimit)).To(Equal(reflect.ValueOf(allow)))
+		})
+
+		It("is replaced by RetryLimit", func() {
+			client := NewClient([]string{"endpoint"}, StatefulRetryLimit(allow), RetryLimit(retry.NoRetries()))
+			Expect(client.statefulLimit).To(BeNil())
+		})
+	})
+
+	Describe("StatefulRetryDelay", func() {
+		var delay retry.StatefulDelay = func(_ retry.State) time.Duration { return 0 }
+
+		It("sets a stateful retry delay", func() {
+			client := NewClient([]string{"endpoint"}, StatefulRetryDelay(delay))
+			Expect(reflect.ValueOf(client.statefulDelay)).To(Equal(reflect.ValueOf(delay)))
+		})
+
+		It("is replaced by RetryDelay", func() {
+			client := NewClient([]string{"endpoint"}, StatefulRetryDelay(delay), RetryDelay(retry.NoDelay()))
+			Expect(client.statefulDelay).To(BeNil())
+		})
+	})
+
+	Describe("RetryObserver", func() {
+		It("installs observers", func() {
+			a, b := new(nopObserver), new(nopObserver)
+			client := NewClient([]string{"endpoint"}, RetryObserver(a), RetryObserver(b))
+			Expect(client.observers).To(HaveLen(2))
+			Expect(client.observers[0]).To(BeIdenticalTo(a))
+			Expect(client.observers[1]).To(BeIdenticalTo(b))
+		})
+	})
+
 	Describe("RetryDelay", func() {
 		var delay retry.Delay = func(_ uint) time.Duration { return 0 }
 
@@ -107,3 +184,9 @@ var _ = Describe("client options", func() {
 		})
 	})
 })
+
+type nopObserver struct{}
+
+func (o *nopObserver) Before(_ retry.Attempt) {}
+
+func (o *nopObserver) After(_ retry.Attempt) {}
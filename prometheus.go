@@ -0,0 +1,134 @@
+package eureka
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// prometheusLabelPrefix is the prefix of the labels attached to targets. The
+// labels are named like those of Prometheus' built-in Eureka discovery, so
+// relabeling rules written for it keep working.
+const prometheusLabelPrefix = "__meta_eureka_"
+
+// PrometheusTargetGroup is a group of targets as served to Prometheus' HTTP
+// service discovery, see http_sd_config.
+type PrometheusTargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels"`
+}
+
+// PrometheusTargets returns a target group for every instance of the given
+// apps, ordered by app name and instance ID. Targets are built from the IP
+// address, or the host name if no address is set, and the port of an
+// instance. The labels describe the app, status, VIPs and zone of an
+// instance, plus the given metadata keys if the instance defines them.
+func PrometheusTargets(apps []*App, metadataKeys ...string) []PrometheusTargetGroup {
+	sorted := append([]*App(nil), apps...)
+	sort.Slice(sorted, func(a, b int) bool {
+		return sorted[a].Name < sorted[b].Name
+	})
+
+	groups := []PrometheusTargetGroup{}
+
+	for _, app := range sorted {
+		instances := append([]*Instance(nil), app.Instances...)
+		sort.Slice(instances, func(a, b int) bool {
+			return instances[a].ID < instances[b].ID
+		})
+
+		for _, i := range instances {
+			groups = append(groups, PrometheusTargetGroup{
+				Targets: []string{i.Address(false)},
+				Labels:  prometheusLabels(app.Name, i, metadataKeys),
+			})
+		}
+	}
+
+	return groups
+}
+
+func prometheusLabels(appName string, i *Instance, metadataKeys []string) map[string]string {
+	labels := make(map[string]string)
+
+	set := func(name, value string) {
+		if value != "" {
+			labels[prometheusLabelPrefix+name] = value
+		}
+	}
+
+	set("app_name", appName)
+	set("app_instance_id", i.ID)
+	set("app_instance_hostname", i.HostName)
+	set("app_instance_ip_addr", i.IPAddr)
+	set("app_instance_status", i.Status.String())
+	set("app_instance_port", strconv.Itoa(int(i.Port)))
+	set("app_instance_secure_port", strconv.Itoa(int(i.SecurePort)))
+	set("app_instance_vip_address", i.VIPAddr)
+	set("app_instance_secure_vip_address", i.SecureVIPAddr)
+	set("app_instance_zone", i.Zone())
+
+	for _, key := range metadataKeys {
+		set("app_instance_metadata_"+prometheusLabelName(key), i.Metadata[key])
+	}
+
+	return labels
+}
+
+// prometheusLabelName replaces the characters that are not allowed in label
+// names with underscores.
+func prometheusLabelName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// PrometheusHandler serves the instances observed by a watcher to
+// Prometheus' HTTP service discovery. It responds with 503 Service
+// Unavailable until the watcher has synced, Prometheus keeps its previous
+// targets in the meantime.
+type PrometheusHandler struct {
+	watcher      *Watcher
+	metadataKeys []string
+}
+
+// NewPrometheusHandler returns a handler that serves the current snapshot of
+// the given watcher, labeled with the given metadata keys, see
+// PrometheusTargets.
+func NewPrometheusHandler(watcher *Watcher, metadataKeys ...string) *PrometheusHandler {
+	return &PrometheusHandler{
+		watcher:      watcher,
+		metadataKeys: metadataKeys,
+	}
+}
+
+func (h *PrometheusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-h.watcher.synced:
+	default:
+		http.Error(w, "Registry has not been synced yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	snapshot := h.watcher.Snapshot()
+
+	apps := make([]*App, 0, len(snapshot))
+	for name, instances := range snapshot {
+		apps = append(apps, &App{Name: name, Instances: instances})
+	}
+
+	data, err := json.Marshal(PrometheusTargets(apps, h.metadataKeys...))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
@@ -0,0 +1,157 @@
+package eureka_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/go-eureka"
+	"github.com/st3v/go-eureka/fake"
+	"github.com/st3v/go-eureka/retry"
+)
+
+var _ = Describe("Prometheus", func() {
+	var (
+		one = &eureka.Instance{
+			ID:            "one",
+			AppName:       "ORDERS",
+			HostName:      "one.example.com",
+			IPAddr:        "10.0.0.1",
+			Status:        eureka.StatusUp,
+			Port:          8080,
+			SecurePort:    8443,
+			VIPAddr:       "orders",
+			SecureVIPAddr: "orders-secure",
+			DataCenterInfo: eureka.DataCenter{
+				Type:     eureka.DataCenterTypeAmazon,
+				Metadata: eureka.AmazonMetadata{AvailabilityZone: "us-east-1a"},
+			},
+			Metadata: eureka.Metadata{"version": "1.2", "team.name": "shop", "secret": "s3cr3t"},
+		}
+
+		two = &eureka.Instance{
+			ID:       "two",
+			AppName:  "BILLING",
+			HostName: "two.example.com",
+			Status:   eureka.StatusDown,
+			Port:     9090,
+		}
+	)
+
+	Describe("PrometheusTargets", func() {
+		It("returns a target group per instance", func() {
+			groups := eureka.PrometheusTargets([]*eureka.App{
+				{Name: "ORDERS", Instances: []*eureka.Instance{one}},
+				{Name: "BILLING", Instances: []*eureka.Instance{two}},
+			}, "version", "team.name", "missing")
+
+			Expect(groups).To(Equal([]eureka.PrometheusTargetGroup{
+				{
+					Targets: []string{"two.example.com:9090"},
+					Labels: map[string]string{
+						"__meta_eureka_app_name":                 "BILLING",
+						"__meta_eureka_app_instance_id":          "two",
+						"__meta_eureka_app_instance_hostname":    "two.example.com",
+						"__meta_eureka_app_instance_status":      "DOWN",
+						"__meta_eureka_app_instance_port":        "9090",
+						"__meta_eureka_app_instance_secure_port": "0",
+					},
+				},
+				{
+					Targets: []string{"10.0.0.1:8080"},
+					Labels: map[string]string{
+						"__meta_eureka_app_name":                        "ORDERS",
+						"__meta_eureka_app_instance_id":                 "one",
+						"__meta_eureka_app_instance_hostname":           "one.example.com",
+						"__meta_eureka_app_instance_ip_addr":            "10.0.0.1",
+						"__meta_eureka_app_instance_status":             "UP",
+						"__meta_eureka_app_instance_port":               "8080",
+						"__meta_eureka_app_instance_secure_port":        "8443",
+						"__meta_eureka_app_instance_vip_address":        "orders",
+						"__meta_eureka_app_instance_secure_vip_address": "orders-secure",
+						"__meta_eureka_app_instance_zone":               "us-east-1a",
+						"__meta_eureka_app_instance_metadata_version":   "1.2",
+						"__meta_eureka_app_instance_metadata_team_name": "shop",
+					},
+				},
+			}))
+		})
+
+		It("serializes to an empty list without instances", func() {
+			data, err := json.Marshal(eureka.PrometheusTargets(nil))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(Equal("[]"))
+		})
+	})
+
+	Describe("PrometheusHandler", func() {
+		var (
+			client  *fake.Client
+			watcher *eureka.Watcher
+			server  *httptest.Server
+		)
+
+		BeforeEach(func() {
+			client = fake.NewClient()
+			Expect(client.Register(one)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			server.Close()
+			watcher.Stop()
+		})
+
+		get := func() (int, []eureka.PrometheusTargetGroup) {
+			resp, err := http.Get(server.URL)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+
+			var groups []eureka.PrometheusTargetGroup
+			if resp.StatusCode == http.StatusOK {
+				Expect(resp.Header.Get("Content-Type")).To(Equal("application/json"))
+				Expect(json.NewDecoder(resp.Body).Decode(&groups)).To(Succeed())
+			}
+
+			return resp.StatusCode, groups
+		}
+
+		targets := func() []string {
+			_, groups := get()
+
+			var targets []string
+			for _, g := range groups {
+				targets = append(targets, g.Targets...)
+			}
+			return targets
+		}
+
+		It("serves the instances observed by the watcher", func() {
+			watcher = client.Watch(10 * time.Millisecond)
+			server = httptest.NewServer(eureka.NewPrometheusHandler(watcher, "version"))
+
+			Eventually(targets).Should(Equal([]string{"10.0.0.1:8080"}))
+
+			_, groups := get()
+			Expect(groups[0].Labels).To(HaveKeyWithValue("__meta_eureka_app_instance_metadata_version", "1.2"))
+			Expect(groups[0].Labels).ToNot(HaveKey("__meta_eureka_app_instance_metadata_secret"))
+
+			Expect(client.Register(two)).To(Succeed())
+			Eventually(targets).Should(Equal([]string{"two.example.com:9090", "10.0.0.1:8080"}))
+		})
+
+		It("is unavailable until the watcher has synced", func() {
+			registry := httptest.NewServer(http.NotFoundHandler())
+			registry.Close()
+
+			watcher = eureka.NewClient([]string{registry.URL}, eureka.RetryLimit(retry.NoRetries())).Watch(time.Hour)
+			server = httptest.NewServer(eureka.NewPrometheusHandler(watcher))
+
+			code, _ := get()
+			Expect(code).To(Equal(http.StatusServiceUnavailable))
+		})
+	})
+})
@@ -0,0 +1,259 @@
+package eureka
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// OverflowPolicy defines how a watcher handles events that exceed its buffer,
+// i.e. events that are observed faster than they are being consumed.
+type OverflowPolicy uint8
+
+const (
+	// OverflowBlock blocks polling until the consumer caught up. Other
+	// subscriptions of the watcher do not receive any new events in the
+	// meantime, but can still be created and cancelled.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDropOldest drops the oldest buffered event to make room for the
+	// newest one.
+	OverflowDropOldest
+
+	// OverflowCoalesce merges events for the same instance that are still
+	// buffered, so that the consumer only observes the latest change per
+	// instance. Polling blocks if the buffer is full of events for distinct
+	// instances.
+	OverflowCoalesce
+)
+
+type queuedEvent struct {
+	key   string
+	event Event
+	at    time.Time
+}
+
+// eventQueue buffers events in-between the poll loop of a watcher and its
+// consumer. Coalesced updates are typed using classify.
+type eventQueue struct {
+	mtx      sync.Mutex
+	size     int
+	policy   OverflowPolicy
+	items    []queuedEvent
+	ready    chan struct{}
+	space    chan struct{}
+	classify func(prev, next *Instance) EventType
+}
+
+func newEventQueue(size int, policy OverflowPolicy) *eventQueue {
+	if size < 1 {
+		size = 1
+	}
+
+	return &eventQueue{
+		size:   size,
+		policy: policy,
+		ready:  make(chan struct{}, 1),
+		space:  make(chan struct{}, 1),
+		classify: func(*Instance, *Instance) EventType {
+			return EventInstanceUpdated
+		},
+	}
+}
+
+// push adds an event to the queue. Depending on the overflow policy it blocks
+// until there is space in the queue. It returns false if ctx is done before
+// the event could be added.
+func (q *eventQueue) push(ctx context.Context, key string, e Event) bool {
+	item := queuedEvent{key: key, event: e}
+
+	for {
+		q.mtx.Lock()
+
+		switch {
+		case q.policy == OverflowCoalesce && q.coalesce(item):
+		case len(q.items) < q.size:
+			q.items = append(q.items, item)
+		case q.policy == OverflowDropOldest:
+			q.items = append(q.items[1:], item)
+		default:
+			q.mtx.Unlock()
+
+			select {
+			case <-q.space:
+				continue
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		q.mtx.Unlock()
+		signal(q.ready)
+		return true
+	}
+}
+
+// prime adds events to the queue without blocking. Unless the overflow policy
+// is OverflowDropOldest, the events are added regardless of the queue size.
+func (q *eventQueue) prime(items []queuedEvent) {
+	if len(items) == 0 {
+		return
+	}
+
+	q.mtx.Lock()
+	q.items = append(q.items, items...)
+	if q.policy == OverflowDropOldest && len(q.items) > q.size {
+		q.items = q.items[len(q.items)-q.size:]
+	}
+	q.mtx.Unlock()
+
+	signal(q.ready)
+}
+
+// pop removes the oldest event from the queue, blocking until there is one.
+// It returns false if ctx is done before an event became available.
+func (q *eventQueue) pop(ctx context.Context) (Event, bool) {
+	item, ok := q.next(ctx, nil)
+	return item.event, ok
+}
+
+// next removes the oldest item from the queue, blocking until there is one.
+// It returns false if ctx is done or timeout fires before an item became
+// available.
+func (q *eventQueue) next(ctx context.Context, timeout <-chan time.Time) (queuedEvent, bool) {
+	for {
+		q.mtx.Lock()
+
+		if len(q.items) > 0 {
+			item := q.items[0]
+			q.items = q.items[1:]
+			q.mtx.Unlock()
+
+			signal(q.space)
+			return item, true
+		}
+
+		q.mtx.Unlock()
+
+		select {
+		case <-q.ready:
+		case <-timeout:
+			return queuedEvent{}, false
+		case <-ctx.Done():
+			return queuedEvent{}, false
+		}
+	}
+}
+
+// add adds an item to the queue regardless of its size, coalescing it with
+// queued items for the same instance if the policy says so.
+func (q *eventQueue) add(item queuedEvent) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.policy == OverflowCoalesce && q.coalesce(item) {
+		return
+	}
+
+	q.items = append(q.items, item)
+}
+
+// take removes and returns the items that satisfy the given predicate.
+func (q *eventQueue) take(predicate func(queuedEvent) bool) []queuedEvent {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	var taken []queuedEvent
+	kept := q.items[:0]
+	for _, item := range q.items {
+		if predicate(item) {
+			taken = append(taken, item)
+		} else {
+			kept = append(kept, item)
+		}
+	}
+	q.items = kept
+
+	return taken
+}
+
+// count returns the number of queued items.
+func (q *eventQueue) count() int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return len(q.items)
+}
+
+// coalesce merges the given event into a queued event for the same instance.
+// It returns false if there is no such event or if the latest queued event for
+// the instance must not be merged, e.g. a lease expiry.
+func (q *eventQueue) coalesce(item queuedEvent) bool {
+	if !coalescable(item.event) {
+		return false
+	}
+
+	for i := len(q.items) - 1; i >= 0; i-- {
+		queued := q.items[i]
+		if queued.key != item.key {
+			continue
+		}
+
+		if !coalescable(queued.event) {
+			return false
+		}
+
+		prev, next := queued.event, item.event
+
+		var merged Event
+
+		switch {
+		case prev.Type == EventInstanceRegistered && next.Type == EventInstanceDeregistered:
+			// the consumer never learned about the instance
+			q.remove(i)
+			return true
+		case prev.Type == EventInstanceRegistered:
+			merged = Event{EventInstanceRegistered, next.Instance, nil}
+		case prev.Type == EventInstanceDeregistered && next.Type == EventInstanceRegistered:
+			// the consumer still knows the deregistered instance
+			merged = q.update(prev.Instance, next.Instance)
+		case prev.Type != EventInstanceDeregistered && next.Type != EventInstanceDeregistered:
+			// the consumer still knows the instance prior to the queued update
+			merged = q.update(prev.Previous, next.Instance)
+		default:
+			merged = next
+		}
+
+		if merged.Previous != nil && merged.Previous.Equals(merged.Instance) {
+			// the consumer already knows the latest state
+			q.remove(i)
+			return true
+		}
+
+		q.items[i].event = merged
+		return true
+	}
+
+	return false
+}
+
+// coalescable checks if an event may be merged with other events for the same
+// instance. Warnings and lease expiries are never merged.
+func coalescable(e Event) bool {
+	return e.Instance != nil && e.Type != EventInstanceLeaseExpired
+}
+
+func (q *eventQueue) update(prev, next *Instance) Event {
+	return Event{q.classify(prev, next), next, prev}
+}
+
+func (q *eventQueue) remove(i int) {
+	q.items = append(q.items[:i], q.items[i+1:]...)
+}
+
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,169 @@
+package eureka
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("eventQueue", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+
+		one = &Instance{ID: "one"}
+		two = &Instance{ID: "two"}
+		mid = &Instance{ID: "one", HostName: "mid"}
+		new = &Instance{ID: "one", HostName: "new"}
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	popAll := func(q *eventQueue) []Event {
+		var events []Event
+		for {
+			q.mtx.Lock()
+			n := len(q.items)
+			q.mtx.Unlock()
+
+			if n == 0 {
+				return events
+			}
+
+			e, _ := q.pop(ctx)
+			events = append(events, e)
+		}
+	}
+
+	Describe("OverflowBlock", func() {
+		It("blocks until there is space", func() {
+			q := newEventQueue(1, OverflowBlock)
+			Expect(q.push(ctx, "one", Event{EventInstanceRegistered, one, nil})).To(BeTrue())
+
+			pushed := make(chan bool)
+			go func() {
+				pushed <- q.push(ctx, "two", Event{EventInstanceRegistered, two, nil})
+			}()
+
+			Consistently(pushed).ShouldNot(Receive())
+
+			e, ok := q.pop(ctx)
+			Expect(ok).To(BeTrue())
+			Expect(e).To(Equal(Event{EventInstanceRegistered, one, nil}))
+			Eventually(pushed).Should(Receive(BeTrue()))
+			e, ok = q.pop(ctx)
+			Expect(ok).To(BeTrue())
+			Expect(e).To(Equal(Event{EventInstanceRegistered, two, nil}))
+		})
+
+		It("gives up once the context is done", func() {
+			q := newEventQueue(1, OverflowBlock)
+			q.push(ctx, "one", Event{EventInstanceRegistered, one, nil})
+
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				cancel()
+			}()
+
+			Expect(q.push(ctx, "two", Event{EventInstanceRegistered, two, nil})).To(BeFalse())
+		})
+	})
+
+	Describe("OverflowDropOldest", func() {
+		It("drops the oldest event", func() {
+			q := newEventQueue(2, OverflowDropOldest)
+			q.push(ctx, "one", Event{EventInstanceRegistered, one, nil})
+			q.push(ctx, "two", Event{EventInstanceRegistered, two, nil})
+			q.push(ctx, "one", Event{EventInstanceUpdated, new, nil})
+
+			Expect(popAll(q)).To(Equal([]Event{
+				{EventInstanceRegistered, two, nil},
+				{EventInstanceUpdated, new, nil},
+			}))
+		})
+	})
+
+	Describe("OverflowCoalesce", func() {
+		It("keeps the latest update per instance", func() {
+			q := newEventQueue(10, OverflowCoalesce)
+			q.push(ctx, "one", Event{EventInstanceUpdated, mid, one})
+			q.push(ctx, "two", Event{EventInstanceRegistered, two, nil})
+			q.push(ctx, "one", Event{EventInstanceUpdated, new, mid})
+
+			Expect(popAll(q)).To(Equal([]Event{
+				{EventInstanceUpdated, new, one},
+				{EventInstanceRegistered, two, nil},
+			}))
+		})
+
+		It("drops updates that have been reverted", func() {
+			q := newEventQueue(10, OverflowCoalesce)
+			q.push(ctx, "one", Event{EventInstanceUpdated, new, one})
+			q.push(ctx, "one", Event{EventInstanceUpdated, one, new})
+
+			Expect(popAll(q)).To(BeEmpty())
+		})
+
+		It("classifies coalesced updates", func() {
+			q := newEventQueue(10, OverflowCoalesce)
+			q.classify = func(prev, next *Instance) EventType {
+				Expect(prev).To(Equal(one))
+				Expect(next).To(Equal(new))
+				return EventInstanceDown
+			}
+
+			q.push(ctx, "one", Event{EventInstanceUpdated, mid, one})
+			q.push(ctx, "one", Event{EventInstanceUpdated, new, mid})
+
+			Expect(popAll(q)).To(Equal([]Event{{EventInstanceDown, new, one}}))
+		})
+
+		It("reports updates of unseen instances as registrations", func() {
+			q := newEventQueue(10, OverflowCoalesce)
+			q.push(ctx, "one", Event{EventInstanceRegistered, one, nil})
+			q.push(ctx, "one", Event{EventInstanceUpdated, new, nil})
+
+			Expect(popAll(q)).To(Equal([]Event{{EventInstanceRegistered, new, nil}}))
+		})
+
+		It("drops instances that came and went", func() {
+			q := newEventQueue(10, OverflowCoalesce)
+			q.push(ctx, "one", Event{EventInstanceRegistered, one, nil})
+			q.push(ctx, "one", Event{EventInstanceDeregistered, one, nil})
+
+			Expect(popAll(q)).To(BeEmpty())
+		})
+
+		It("reports instances that went and came back as updated", func() {
+			q := newEventQueue(10, OverflowCoalesce)
+			q.push(ctx, "one", Event{EventInstanceDeregistered, one, nil})
+			q.push(ctx, "one", Event{EventInstanceRegistered, new, nil})
+
+			Expect(popAll(q)).To(Equal([]Event{{EventInstanceUpdated, new, one}}))
+		})
+
+		It("blocks if the buffer is full of distinct instances", func() {
+			q := newEventQueue(1, OverflowCoalesce)
+			q.push(ctx, "one", Event{EventInstanceRegistered, one, nil})
+			Expect(q.push(ctx, "one", Event{EventInstanceUpdated, new, nil})).To(BeTrue())
+
+			pushed := make(chan bool)
+			go func() {
+				pushed <- q.push(ctx, "two", Event{EventInstanceRegistered, two, nil})
+			}()
+
+			Consistently(pushed).ShouldNot(Receive())
+			q.pop(ctx)
+			Eventually(pushed).Should(Receive(BeTrue()))
+		})
+	})
+})
@@ -0,0 +1,208 @@
+// Package resolver provides a gRPC name resolver for apps registered with
+// Eureka. Targets of the form eureka:///APPNAME resolve to the addresses of
+// the app's instances that are UP.
+package resolver
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/attributes"
+	grpcresolver "google.golang.org/grpc/resolver"
+
+	"github.com/st3v/go-eureka"
+)
+
+// Scheme is the scheme of targets resolved by a Builder.
+const Scheme = "eureka"
+
+type zoneKey struct{}
+
+type metadataKey struct{}
+
+// Builder builds resolvers that watch the registry for the instances of the
+// app named by the target. Register it with gRPC using resolver.Register or
+// the grpc.WithResolvers dial option.
+type Builder struct {
+	registry     eureka.Registry
+	pollInterval time.Duration
+	secure       bool
+	options      []eureka.WatchOption
+}
+
+// Option can be used to configure a Builder.
+type Option func(*Builder)
+
+// SecurePort makes resolvers use the secure port of instances instead of
+// their regular port.
+func SecurePort() Option {
+	return func(b *Builder) {
+		b.secure = true
+	}
+}
+
+// WatchOptions configures the watchers used by resolvers, e.g. to enable
+// self-preservation. Resolvers always watch a single app.
+func WatchOptions(options ...eureka.WatchOption) Option {
+	return func(b *Builder) {
+		b.options = append(b.options, options...)
+	}
+}
+
+// NewBuilder returns a builder for resolvers that poll the given registry at
+// the defined interval.
+func NewBuilder(registry eureka.Registry, pollInterval time.Duration, options ...Option) *Builder {
+	b := &Builder{
+		registry:     registry,
+		pollInterval: pollInterval,
+	}
+
+	for _, opt := range options {
+		opt(b)
+	}
+
+	return b
+}
+
+// Scheme returns the scheme of targets resolved by the builder.
+func (b *Builder) Scheme() string {
+	return Scheme
+}
+
+// Build starts watching the app named by the target and pushes the
+// addresses of its instances to the given client connection whenever they
+// change. Errors that occur while polling the registry are reported to the
+// client connection.
+func (b *Builder) Build(target grpcresolver.Target, cc grpcresolver.ClientConn, _ grpcresolver.BuildOptions) (grpcresolver.Resolver, error) {
+	app := strings.TrimPrefix(target.URL.Path, "/")
+	if app == "" {
+		app = target.URL.Opaque
+	}
+
+	// Eureka stores app names in upper case
+	app = strings.ToUpper(app)
+
+	options := append([]eureka.WatchOption{eureka.WatchApps(app)}, b.options...)
+	watcher := eureka.NewWatcher(b.registry, b.pollInterval, options...)
+
+	r := &resolver{
+		watcher:  watcher,
+		batches:  watcher.SubscribeBatches(0),
+		cc:       cc,
+		secure:   b.secure,
+		done:     make(chan struct{}),
+		reported: make(chan struct{}),
+	}
+
+	go r.run()
+	go r.reportErrors()
+
+	return r, nil
+}
+
+type resolver struct {
+	watcher  *eureka.Watcher
+	batches  *eureka.Subscription
+	cc       grpcresolver.ClientConn
+	secure   bool
+	done     chan struct{}
+	reported chan struct{}
+	once     sync.Once
+}
+
+// run pushes the addresses once the watcher has synced and again whenever
+// the watcher observes changes.
+func (r *resolver) run() {
+	defer close(r.done)
+
+	if err := r.watcher.WaitForSync(context.Background()); err != nil {
+		return
+	}
+
+	r.update()
+
+	for range r.batches.Batches() {
+		r.update()
+	}
+}
+
+// reportErrors forwards the errors that occur while polling the registry to
+// the client connection until run returns, which lets gRPC fail RPCs instead
+// of waiting for addresses that might never arrive.
+func (r *resolver) reportErrors() {
+	defer close(r.reported)
+
+	for {
+		select {
+		case err, ok := <-r.watcher.Errors():
+			if !ok {
+				return
+			}
+			r.cc.ReportError(err)
+		case <-r.done:
+			return
+		}
+	}
+}
+
+func (r *resolver) update() {
+	var addrs []grpcresolver.Address
+
+	for _, instances := range r.watcher.Snapshot() {
+		for _, i := range instances {
+			if i.Status == eureka.StatusUp {
+				addrs = append(addrs, r.address(i))
+			}
+		}
+	}
+
+	// a stable order avoids needless updates of the connection
+	sort.Slice(addrs, func(a, b int) bool {
+		return addrs[a].Addr < addrs[b].Addr
+	})
+
+	r.cc.UpdateState(grpcresolver.State{Addresses: addrs})
+}
+
+func (r *resolver) address(i *eureka.Instance) grpcresolver.Address {
+	return grpcresolver.Address{
+		Addr:       i.Address(r.secure),
+		Attributes: attributes.New(zoneKey{}, i.Zone()).WithValue(metadataKey{}, metadata(i.Metadata)),
+	}
+}
+
+// ResolveNow is a no-op, the watcher keeps polling the registry anyway.
+func (r *resolver) ResolveNow(grpcresolver.ResolveNowOptions) {}
+
+// Close stops watching the registry.
+func (r *resolver) Close() {
+	r.once.Do(func() {
+		r.watcher.Stop()
+		<-r.done
+		<-r.reported
+	})
+}
+
+// Zone returns the zone of the instance behind the given address, i.e. its
+// AWS availability zone or the zone announced in its metadata.
+func Zone(addr grpcresolver.Address) string {
+	zone, _ := addr.Attributes.Value(zoneKey{}).(string)
+	return zone
+}
+
+// Metadata returns the metadata of the instance behind the given address.
+func Metadata(addr grpcresolver.Address) eureka.Metadata {
+	m, _ := addr.Attributes.Value(metadataKey{}).(metadata)
+	return eureka.Metadata(m)
+}
+
+// metadata can be compared by gRPC, which is required for attribute values.
+type metadata eureka.Metadata
+
+func (m metadata) Equal(o interface{}) bool {
+	other, ok := o.(metadata)
+	return ok && eureka.Metadata(m).Equals(eureka.Metadata(other))
+}
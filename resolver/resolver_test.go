@@ -0,0 +1,236 @@
+package resolver_test
+
+import (
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	grpcresolver "google.golang.org/grpc/resolver"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/go-eureka"
+	"github.com/st3v/go-eureka/fake"
+	"github.com/st3v/go-eureka/resolver"
+	"github.com/st3v/go-eureka/retry"
+)
+
+var _ = Describe("Builder", func() {
+	var (
+		interval = 10 * time.Millisecond
+		registry *httptest.Server
+		client   *eureka.Client
+		builder  *resolver.Builder
+		server   *grpc.Server
+		listener net.Listener
+		instance *eureka.Instance
+	)
+
+	BeforeEach(func() {
+		registry = httptest.NewServer(fake.NewRegistry().HTTPServer("", false).Handler)
+		client = eureka.NewClient([]string{registry.URL})
+		builder = resolver.NewBuilder(client, interval)
+
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+
+		server = grpc.NewServer()
+		healthpb.RegisterHealthServer(server, health.NewServer())
+		go server.Serve(listener)
+
+		port := listener.Addr().(*net.TCPAddr).Port
+
+		instance = &eureka.Instance{
+			ID:         "one",
+			AppName:    "ORDERS",
+			HostName:   "localhost",
+			IPAddr:     "127.0.0.1",
+			Status:     eureka.StatusUp,
+			Port:       eureka.Port(port),
+			SecurePort: 8443,
+			DataCenterInfo: eureka.DataCenter{
+				Type: eureka.DataCenterTypePrivate,
+			},
+			Metadata: eureka.Metadata{"zone": "zone-a", "version": "1"},
+		}
+	})
+
+	AfterEach(func() {
+		server.Stop()
+		registry.Close()
+	})
+
+	It("uses the eureka scheme", func() {
+		Expect(builder.Scheme()).To(Equal("eureka"))
+	})
+
+	It("resolves apps for gRPC clients", func() {
+		Expect(client.Register(instance)).To(Succeed())
+
+		conn, err := grpc.NewClient("eureka:///orders",
+			grpc.WithResolvers(builder),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.Status).To(Equal(healthpb.HealthCheckResponse_SERVING))
+	})
+
+	Describe("resolvers", func() {
+		var (
+			cc *recordingClientConn
+			r  grpcresolver.Resolver
+		)
+
+		build := func(b *resolver.Builder) {
+			var err error
+			r, err = b.Build(grpcresolver.Target{URL: mustParse("eureka:///ORDERS")}, cc, grpcresolver.BuildOptions{})
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			cc = &recordingClientConn{}
+		})
+
+		AfterEach(func() {
+			r.Close()
+		})
+
+		It("pushes the addresses of instances that are up", func() {
+			down := *instance
+			down.ID = "two"
+			down.IPAddr = "127.0.0.2"
+			down.Status = eureka.StatusDown
+
+			Expect(client.Register(instance)).To(Succeed())
+			Expect(client.Register(&down)).To(Succeed())
+
+			build(builder)
+
+			Eventually(cc.Addrs).Should(Equal([]string{listener.Addr().String()}))
+		})
+
+		It("passes zone and metadata as attributes", func() {
+			Expect(client.Register(instance)).To(Succeed())
+
+			build(builder)
+
+			Eventually(cc.Addresses).Should(HaveLen(1))
+
+			addr := cc.Addresses()[0]
+			Expect(resolver.Zone(addr)).To(Equal("zone-a"))
+			Expect(resolver.Metadata(addr)).To(Equal(instance.Metadata))
+		})
+
+		It("uses the secure port if asked to", func() {
+			Expect(client.Register(instance)).To(Succeed())
+
+			build(resolver.NewBuilder(client, interval, resolver.SecurePort()))
+
+			Eventually(cc.Addrs).Should(Equal([]string{"127.0.0.1:8443"}))
+		})
+
+		It("reports errors that occur while polling", func() {
+			unavailable := httptest.NewServer(nil)
+			unavailable.Close()
+
+			build(resolver.NewBuilder(
+				eureka.NewClient([]string{unavailable.URL}, eureka.RetryLimit(retry.NoRetries())),
+				interval,
+			))
+
+			Eventually(cc.Errors).Should(BeNumerically(">", 0))
+			Expect(cc.Updates()).To(BeZero())
+		})
+
+		It("pushes changes", func() {
+			build(builder)
+
+			// requests for unknown apps are retried, polls take a while
+			timeout := 5 * time.Second
+
+			Eventually(cc.Updates, timeout).Should(BeNumerically(">", 0))
+			Expect(cc.Addrs()).To(BeEmpty())
+
+			Expect(client.Register(instance)).To(Succeed())
+			Eventually(cc.Addrs, timeout).Should(HaveLen(1))
+
+			Expect(client.Deregister(instance)).To(Succeed())
+			Eventually(cc.Addrs, timeout).Should(BeEmpty())
+		})
+	})
+})
+
+// recordingClientConn records the latest state pushed by a resolver and the
+// number of errors it reported.
+type recordingClientConn struct {
+	grpcresolver.ClientConn
+
+	mtx     sync.Mutex
+	state   grpcresolver.State
+	updates int
+	errors  int
+}
+
+func (c *recordingClientConn) UpdateState(state grpcresolver.State) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.state = state
+	c.updates++
+	return nil
+}
+
+func (c *recordingClientConn) ReportError(err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.errors++
+}
+
+func (c *recordingClientConn) Errors() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.errors
+}
+
+func (c *recordingClientConn) Updates() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.updates
+}
+
+func (c *recordingClientConn) Addresses() []grpcresolver.Address {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.state.Addresses
+}
+
+func (c *recordingClientConn) Addrs() []string {
+	var addrs []string
+	for _, a := range c.Addresses() {
+		addrs = append(addrs, a.Addr)
+	}
+	return addrs
+}
+
+func mustParse(target string) url.URL {
+	u, err := url.Parse(target)
+	Expect(err).ToNot(HaveOccurred())
+	return *u
+}
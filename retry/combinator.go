@@ -0,0 +1,101 @@
+package retry
+
+import "time"
+
+// State describes the progress of a strategy at the time it decides whether
+// and when to make the next attempt.
+type State struct {
+	// Attempt is the number of the upcoming attempt, starting at 0.
+	Attempt uint
+
+	// Elapsed is the time passed since the first attempt has been started.
+	Elapsed time.Duration
+
+	// Err is the error returned by the previous attempt, nil for attempt 0.
+	Err error
+
+	// PreviousDelay is the time the strategy waited before the previous
+	// attempt, zero for attempt 0.
+	PreviousDelay time.Duration
+
+	// Delay is the time the strategy waits before the upcoming attempt,
+	// including a delay requested by Err. It is only set for allowances.
+	Delay time.Duration
+}
+
+// StatefulAllow is like Allow but has access to the state of the strategy.
+type StatefulAllow func(state State) bool
+
+// StatefulDelay is like Delay but has access to the state of the strategy.
+type StatefulDelay func(state State) time.Duration
+
+// Stateful turns the allowance into a StatefulAllow that can be combined with
+// other allowances.
+func (a Allow) Stateful() StatefulAllow {
+	return func(state State) bool {
+		return a(state.Attempt)
+	}
+}
+
+// Stateful turns the delay into a StatefulDelay that can be combined with
+// other delays.
+func (d Delay) Stateful() StatefulDelay {
+	return func(state State) time.Duration {
+		return d(state.Attempt)
+	}
+}
+
+// AllOf allows an attempt only if all of the given allowances allow it.
+func AllOf(allows ...StatefulAllow) StatefulAllow {
+	return func(state State) bool {
+		for _, allow := range allows {
+			if !allow(state) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// AnyOf allows an attempt if at least one of the given allowances allows it.
+func AnyOf(allows ...StatefulAllow) StatefulAllow {
+	return func(state State) bool {
+		for _, allow := range allows {
+			if allow(state) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MaxElapsed allows attempts that would start before the given time has
+// passed since the first attempt, taking the delay before the upcoming
+// attempt into account.
+func MaxElapsed(max time.Duration) StatefulAllow {
+	return func(state State) bool {
+		return state.Elapsed+state.Delay < max
+	}
+}
+
+// Cap limits the given delay to max.
+func Cap(delay StatefulDelay, max time.Duration) StatefulDelay {
+	return func(state State) time.Duration {
+		if d := delay(state); d < max {
+			return d
+		}
+		return max
+	}
+}
+
+// Then uses the first delay for the given number of attempts and the next
+// delay for all subsequent attempts. Both delays are passed the absolute
+// attempt number.
+func Then(first StatefulDelay, attempts uint, next StatefulDelay) StatefulDelay {
+	return func(state State) time.Duration {
+		if state.Attempt < attempts {
+			return first(state)
+		}
+		return next(state)
+	}
+}
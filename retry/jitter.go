@@ -0,0 +1,111 @@
+package retry
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Rand is the source of randomness used by jittered delays. It is implemented
+// by *rand.Rand, which allows tests to use a deterministically seeded source.
+type Rand interface {
+	Int63n(n int64) int64
+}
+
+// lockedRand is a Rand that is safe for concurrent use.
+type lockedRand struct {
+	mtx sync.Mutex
+	src *rand.Rand
+}
+
+func newLockedRand() *lockedRand {
+	return &lockedRand{
+		src: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (r *lockedRand) Int63n(n int64) int64 {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.src.Int63n(n)
+}
+
+// FullJitter returns exponentially growing delays starting at base and capped
+// at max, where each delay is picked at random between 0 and the exponential
+// value. The given Rand must be safe for concurrent use if the delay is used
+// by concurrent strategies. A private source is used if r is nil.
+func FullJitter(base, max time.Duration, r Rand) Delay {
+	r = ensureRand(r)
+	return func(attempt uint) time.Duration {
+		if attempt == 0 {
+			return 0
+		}
+		return between(r, 0, capped(base, max, attempt))
+	}
+}
+
+// EqualJitter returns exponentially growing delays starting at base and capped
+// at max, where each delay keeps half of the exponential value and picks the
+// other half at random. A private source is used if r is nil.
+func EqualJitter(base, max time.Duration, r Rand) Delay {
+	r = ensureRand(r)
+	return func(attempt uint) time.Duration {
+		if attempt == 0 {
+			return 0
+		}
+		half := capped(base, max, attempt) / 2
+		return half + between(r, 0, half)
+	}
+}
+
+// DecorrelatedJitter returns delays capped at max, where each delay is picked
+// at random between base and three times the delay the strategy waited before
+// the previous attempt, or base if it waited less. A private source is used if
+// r is nil.
+func DecorrelatedJitter(base, max time.Duration, r Rand) StatefulDelay {
+	r = ensureRand(r)
+	return func(state State) time.Duration {
+		if state.Attempt == 0 {
+			return 0
+		}
+
+		prev := state.PreviousDelay
+		if prev < base {
+			prev = base
+		}
+
+		if delay := between(r, base, 3*prev); delay < max {
+			return delay
+		}
+		return max
+	}
+}
+
+func ensureRand(r Rand) Rand {
+	if r == nil {
+		return newLockedRand()
+	}
+	return r
+}
+
+// capped returns base * 2^(attempt-1), capped at max.
+func capped(base, max time.Duration, attempt uint) time.Duration {
+	delay := base
+	for i := uint(1); i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+
+	if delay > max {
+		return max
+	}
+
+	return delay
+}
+
+// between returns a random duration in the closed interval [min, max].
+func between(r Rand, min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	return min + time.Duration(r.Int63n(int64(max-min)+1))
+}
@@ -0,0 +1,184 @@
+package retry
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultLatencyDecay defines the default weight given to the most recent
+	// observation when updating the moving averages of a LatencySelector.
+	DefaultLatencyDecay = 0.3
+
+	// DefaultExploration defines the default probability with which a
+	// LatencySelector tries another endpoint first instead of the best one.
+	DefaultExploration = 0.05
+
+	// errorPenalty is added to the latency of endpoints in proportion to their
+	// error rate, i.e. an endpoint that always fails scores like one that
+	// takes a second longer to respond, no matter how fast it fails.
+	errorPenalty = time.Second
+)
+
+// Feedback is implemented by selectors that learn from the outcome of the
+// attempts made against the endpoints they selected.
+type Feedback interface {
+	Observe(endpoint string, latency time.Duration, err error)
+}
+
+// FeedbackObserver returns an observer that reports the outcome of every
+// attempt to the given feedback.
+func FeedbackObserver(feedback Feedback) Observer {
+	return feedbackObserver{feedback}
+}
+
+type feedbackObserver struct {
+	feedback Feedback
+}
+
+func (o feedbackObserver) Before(_ Attempt) {}
+
+func (o feedbackObserver) After(attempt Attempt) {
+	o.feedback.Observe(attempt.Endpoint, attempt.Duration, attempt.Err)
+}
+
+// AdaptiveSelector selects endpoints based on previous observations.
+type AdaptiveSelector interface {
+	Feedback
+	Select(endpoints []string) Endpoint
+}
+
+// Score describes how well an endpoint has performed. Lower values are better.
+type Score struct {
+	Endpoint  string
+	Latency   time.Duration
+	ErrorRate float64
+	Samples   uint64
+	Value     float64
+}
+
+func (s Score) String() string {
+	return fmt.Sprintf("%s: score=%.0f latency=%s errors=%.2f samples=%d",
+		s.Endpoint, s.Value, s.Latency, s.ErrorRate, s.Samples)
+}
+
+// LatencySelector orders endpoints by an exponentially weighted moving average
+// of their latency, penalized by their error rate. Endpoints without any
+// observations are tried first. Occasionally, a random endpoint is tried first
+// to learn about endpoints that have recovered. A LatencySelector is safe for
+// concurrent use and is meant to be shared by all strategies of a client.
+type LatencySelector struct {
+	mtx         sync.Mutex
+	decay       float64
+	exploration float64
+	rand        Rand
+	stats       map[string]*Score
+}
+
+var _ AdaptiveSelector = new(LatencySelector)
+
+// NewLatencySelector returns a selector that weighs new observations by decay
+// and explores other endpoints with the given probability. A private source of
+// randomness is used if r is nil.
+func NewLatencySelector(decay, exploration float64, r Rand) *LatencySelector {
+	return &LatencySelector{
+		decay:       decay,
+		exploration: exploration,
+		rand:        ensureRand(r),
+		stats:       map[string]*Score{},
+	}
+}
+
+// Select returns the given endpoints ordered from best to worst, with the
+// order being fixed for all attempts of a single strategy. It can be used as
+// a Selector.
+func (s *LatencySelector) Select(endpoints []string) Endpoint {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	ranked := s.rank(endpoints)
+
+	if len(ranked) > 1 && s.explore() {
+		i := 1 + int(s.rand.Int63n(int64(len(ranked)-1)))
+		ranked[0], ranked[i] = ranked[i], ranked[0]
+	}
+
+	return RoundRobin(ranked)
+}
+
+// Observe records the outcome of an attempt against the given endpoint.
+func (s *LatencySelector) Observe(endpoint string, latency time.Duration, err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	failed := 0.0
+	if err != nil {
+		failed = 1.0
+	}
+
+	score, found := s.stats[endpoint]
+	if !found {
+		score = &Score{
+			Endpoint:  endpoint,
+			Latency:   latency,
+			ErrorRate: failed,
+		}
+		s.stats[endpoint] = score
+	} else {
+		score.Latency = time.Duration(s.decay*float64(latency) + (1-s.decay)*float64(score.Latency))
+		score.ErrorRate = s.decay*failed + (1-s.decay)*score.ErrorRate
+	}
+
+	score.Samples++
+	score.Value = float64(score.Latency) + float64(errorPenalty)*score.ErrorRate
+}
+
+// Scores returns the current scores of all observed endpoints, best first.
+func (s *LatencySelector) Scores() []Score {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	scores := make([]Score, 0, len(s.stats))
+	for _, score := range s.stats {
+		scores = append(scores, *score)
+	}
+
+	sort.Sort(byValue(scores))
+
+	return scores
+}
+
+func (s *LatencySelector) rank(endpoints []string) []string {
+	scores := make([]Score, 0, len(endpoints))
+	for _, e := range endpoints {
+		if score, found := s.stats[e]; found {
+			scores = append(scores, *score)
+			continue
+		}
+
+		// unobserved endpoints score best
+		scores = append(scores, Score{Endpoint: e})
+	}
+
+	sort.Stable(byValue(scores))
+
+	ranked := make([]string, len(scores))
+	for i, score := range scores {
+		ranked[i] = score.Endpoint
+	}
+
+	return ranked
+}
+
+func (s *LatencySelector) explore() bool {
+	const precision = 1000000
+	return s.rand.Int63n(precision) < int64(s.exploration*precision)
+}
+
+type byValue []Score
+
+func (s byValue) Len() int           { return len(s) }
+func (s byValue) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byValue) Less(i, j int) bool { return s[i].Value < s[j].Value }
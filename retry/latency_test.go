@@ -0,0 +1,180 @@
+package retry_test
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/go-eureka/retry"
+)
+
+var _ = Describe("LatencySelector", func() {
+	var (
+		selector  *retry.LatencySelector
+		endpoints = []string{"a", "b", "c"}
+		someErr   = errors.New("some error")
+	)
+
+	BeforeEach(func() {
+		selector = retry.NewLatencySelector(retry.DefaultLatencyDecay, 0, rand.New(rand.NewSource(1)))
+	})
+
+	It("tries unobserved endpoints first", func() {
+		selector.Observe("a", time.Millisecond, nil)
+
+		endpoint := selector.Select(endpoints)
+		Expect(endpoint(0)).To(Equal("b"))
+		Expect(endpoint(1)).To(Equal("c"))
+		Expect(endpoint(2)).To(Equal("a"))
+	})
+
+	It("orders endpoints by latency", func() {
+		selector.Observe("a", 30*time.Millisecond, nil)
+		selector.Observe("b", 10*time.Millisecond, nil)
+		selector.Observe("c", 20*time.Millisecond, nil)
+
+		endpoint := selector.Select(endpoints)
+		Expect(endpoint(0)).To(Equal("b"))
+		Expect(endpoint(1)).To(Equal("c"))
+		Expect(endpoint(2)).To(Equal("a"))
+		Expect(endpoint(3)).To(Equal("b"))
+	})
+
+	It("penalizes endpoints that return errors", func() {
+		selector.Observe("a", 30*time.Millisecond, nil)
+		selector.Observe("b", 10*time.Millisecond, someErr)
+		selector.Observe("c", 20*time.Millisecond, nil)
+
+		endpoint := selector.Select(endpoints)
+		Expect(endpoint(0)).To(Equal("c"))
+		Expect(endpoint(1)).To(Equal("a"))
+		Expect(endpoint(2)).To(Equal("b"))
+	})
+
+	It("keeps a moving average of latency and error rate", func() {
+		selector.Observe("a", 100*time.Millisecond, nil)
+		selector.Observe("a", 200*time.Millisecond, someErr)
+
+		scores := selector.Scores()
+		Expect(scores).To(HaveLen(1))
+		Expect(scores[0].Endpoint).To(Equal("a"))
+		Expect(scores[0].Samples).To(Equal(uint64(2)))
+		Expect(scores[0].Latency).To(Equal(130 * time.Millisecond))
+		Expect(scores[0].ErrorRate).To(BeNumerically("~", 0.3, 0.0001))
+		Expect(scores[0].String()).To(ContainSubstring("latency=130ms"))
+	})
+
+	It("exposes scores ordered from best to worst", func() {
+		selector.Observe("a", 30*time.Millisecond, nil)
+		selector.Observe("b", 10*time.Millisecond, nil)
+		selector.Observe("c", 20*time.Millisecond, nil)
+
+		scores := selector.Scores()
+		Expect(scores).To(HaveLen(3))
+		Expect(scores[0].Endpoint).To(Equal("b"))
+		Expect(scores[1].Endpoint).To(Equal("c"))
+		Expect(scores[2].Endpoint).To(Equal("a"))
+	})
+
+	It("occasionally tries another endpoint first", func() {
+		selector = retry.NewLatencySelector(retry.DefaultLatencyDecay, 0.5, rand.New(rand.NewSource(1)))
+		selector.Observe("a", 10*time.Millisecond, nil)
+		selector.Observe("b", 20*time.Millisecond, nil)
+		selector.Observe("c", 30*time.Millisecond, nil)
+
+		first := map[string]int{}
+		for i := 0; i < 1000; i++ {
+			first[selector.Select(endpoints)(0)]++
+		}
+
+		Expect(first["a"]).To(BeNumerically("~", 500, 75))
+		Expect(first["b"]).To(BeNumerically("~", 250, 75))
+		Expect(first["c"]).To(BeNumerically("~", 250, 75))
+	})
+
+	Describe("simulation", func() {
+		type server struct {
+			latency   time.Duration
+			errorRate float64
+		}
+
+		var (
+			servers map[string]*server
+			random  *rand.Rand
+			first   map[string]int
+		)
+
+		// simulate runs the given number of requests against the simulated
+		// servers, counting which endpoint has been tried first.
+		simulate := func(requests int) {
+			first = map[string]int{}
+
+			for i := 0; i < requests; i++ {
+				attempt := 0
+				strategy := retry.NewStrategy(selector.Select(endpoints), retry.MaxRetries(3), retry.NoDelay())
+
+				strategy.Apply(func(endpoint string) error {
+					if attempt == 0 {
+						first[endpoint]++
+					}
+					attempt++
+
+					s := servers[endpoint]
+					jitter := time.Duration(random.Int63n(int64(s.latency) / 5))
+					latency := s.latency + jitter
+
+					var err error
+					if random.Float64() < s.errorRate {
+						err = someErr
+					}
+
+					selector.Observe(endpoint, latency, err)
+					return err
+				})
+			}
+		}
+
+		BeforeEach(func() {
+			random = rand.New(rand.NewSource(42))
+			selector = retry.NewLatencySelector(retry.DefaultLatencyDecay, retry.DefaultExploration, rand.New(rand.NewSource(7)))
+			servers = map[string]*server{
+				"a": {latency: 80 * time.Millisecond},
+				"b": {latency: 10 * time.Millisecond},
+				"c": {latency: 5 * time.Millisecond, errorRate: 0.5},
+			}
+		})
+
+		It("converges on the fastest reliable endpoint", func() {
+			simulate(2000)
+
+			Expect(first["b"]).To(BeNumerically(">", 1800))
+			Expect(first["a"]).To(BeNumerically(">", 0))
+			Expect(first["c"]).To(BeNumerically(">", 0))
+			Expect(selector.Scores()[0].Endpoint).To(Equal("b"))
+		})
+
+		It("adapts when the best endpoint degrades", func() {
+			simulate(500)
+			Expect(selector.Scores()[0].Endpoint).To(Equal("b"))
+
+			servers["b"].latency = 200 * time.Millisecond
+			simulate(500)
+
+			Expect(first["b"]).To(BeNumerically("<", 100))
+			Expect(selector.Scores()[0].Endpoint).ToNot(Equal("b"))
+		})
+
+		It("avoids endpoints that fail fast", func() {
+			servers["c"] = &server{latency: 200 * time.Microsecond, errorRate: 1}
+
+			simulate(1000)
+
+			Expect(first["c"]).To(BeNumerically("<", 50))
+			Expect(selector.Scores()[0].Endpoint).To(Equal("b"))
+			Expect(selector.Scores()[2].Endpoint).To(Equal("c"))
+		})
+	})
+})
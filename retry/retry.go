@@ -1,8 +1,9 @@
 package retry
 
 import (
+	"fmt"
 	"math"
-	"math/rand"
+	"strings"
 	"time"
 )
 
@@ -22,17 +23,187 @@ type Allow func(attempt uint) bool
 
 type Delay func(attempt uint) time.Duration
 
-func NewStrategy(endpoint Endpoint, allow Allow, delay Delay) Strategy {
+// AfterError can be returned by an Action to request a minimum delay before
+// the next attempt, e.g. when the server asked to retry after a given time.
+// The delay only applies if the next attempt is made against the same
+// endpoint, other endpoints are tried right away.
+type AfterError struct {
+	Err   error
+	Delay time.Duration
+}
+
+// After wraps err to request a delay of at least d before the next attempt.
+func After(err error, d time.Duration) error {
+	return &AfterError{Err: err, Delay: d}
+}
+
+func (e *AfterError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AfterError) Unwrap() error {
+	return e.Err
+}
+
+// Attempt describes a single attempt made by a strategy.
+type Attempt struct {
+	// Number of the attempt, starting at 0.
+	Number uint
+
+	// Endpoint the attempt is made against.
+	Endpoint string
+
+	// Delay the strategy slept for before making the attempt.
+	Delay time.Duration
+
+	// Duration of the attempt, only set once the attempt has been made.
+	Duration time.Duration
+
+	// Err returned by the attempt, only set once the attempt has been made.
+	Err error
+}
+
+// AttemptsError is returned by a strategy once it exhausted its allowance
+// without succeeding. It lists every attempt that has been made along with its
+// endpoint, error and duration. errors.Is and errors.As consider the errors of
+// all attempts.
+type AttemptsError struct {
+	Attempts []Attempt
+}
+
+// Error returns a concise description of the failed attempts. Errors that
+// occurred for every attempt are only printed once.
+func (e *AttemptsError) Error() string {
+	if len(e.Attempts) == 0 {
+		return "no attempts made"
+	}
+
+	last := e.Last().Error()
+
+	same := true
+	for _, a := range e.Attempts {
+		if a.Err.Error() != last {
+			same = false
+			break
+		}
+	}
+
+	switch {
+	case same && len(e.Attempts) == 1:
+		return last
+	case same:
+		return fmt.Sprintf("%s (%d attempts)", last, len(e.Attempts))
+	}
+
+	msgs := make([]string, 0, len(e.Attempts))
+	for _, a := range e.Attempts {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", a.Endpoint, a.Err))
+	}
+
+	return fmt.Sprintf("%d attempts failed: %s", len(e.Attempts), strings.Join(msgs, "; "))
+}
+
+// Last returns the error returned by the last attempt.
+func (e *AttemptsError) Last() error {
+	if len(e.Attempts) == 0 {
+		return nil
+	}
+	return e.Attempts[len(e.Attempts)-1].Err
+}
+
+// Unwrap returns the errors of all attempts.
+func (e *AttemptsError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Attempts))
+	for _, a := range e.Attempts {
+		errs = append(errs, a.Err)
+	}
+	return errs
+}
+
+// Observer is notified before and after each attempt made by a strategy.
+type Observer interface {
+	Before(attempt Attempt)
+	After(attempt Attempt)
+}
+
+func NewStrategy(endpoint Endpoint, allow Allow, delay Delay, observers ...Observer) Strategy {
+	return NewStatefulStrategy(endpoint, allow.Stateful(), delay.Stateful(), observers...)
+}
+
+// NewStatefulStrategy returns a strategy that consults allow and delay with
+// the current state of the retries, including the elapsed time and the error
+// returned by the previous attempt. The given observers are notified before
+// and after each attempt. If all allowed attempts fail, the strategy returns
+// an *AttemptsError.
+func NewStatefulStrategy(endpoint Endpoint, allow StatefulAllow, delay StatefulDelay, observers ...Observer) Strategy {
 	return func(action Action) error {
-		var err error
+		var (
+			err      error
+			start    = time.Now()
+			attempts []Attempt
+		)
+
+		for i := uint(0); i == 0 || err != nil; i++ {
+			state := State{
+				Attempt: i,
+				Elapsed: time.Since(start),
+				Err:     err,
+			}
+
+			if i > 0 {
+				state.PreviousDelay = attempts[i-1].Delay
+			}
+
+			attempt := Attempt{
+				Number:   i,
+				Endpoint: endpoint(i),
+				Delay:    delay(state),
+			}
+
+			// a delay requested by an endpoint only applies to that endpoint
+			if i > 0 && attempt.Endpoint == attempts[i-1].Endpoint {
+				attempt.Delay = requestedDelay(err, attempt.Delay)
+			}
+
+			// allowances know how long the strategy would wait
+			state.Delay = attempt.Delay
+
+			if !allow(state) {
+				break
+			}
+
+			time.Sleep(attempt.Delay)
 
-		for i := uint(0); allow(i) && (i == 0 || err != nil); i++ {
-			time.Sleep(delay(i))
-			err = action(endpoint(i))
+			for _, o := range observers {
+				o.Before(attempt)
+			}
+
+			begin := time.Now()
+			err = action(attempt.Endpoint)
+			attempt.Duration = time.Since(begin)
+			attempt.Err = err
+
+			for _, o := range observers {
+				o.After(attempt)
+			}
+
+			attempts = append(attempts, attempt)
+		}
+
+		if err != nil {
+			return &AttemptsError{Attempts: attempts}
 		}
 
-		return err
+		return nil
+	}
+}
+
+// requestedDelay returns the delay requested by err if it exceeds d.
+func requestedDelay(err error, d time.Duration) time.Duration {
+	if after, ok := err.(*AfterError); ok && after.Delay > d {
+		return after.Delay
 	}
+	return d
 }
 
 func RoundRobin(endpoints []string) Endpoint {
@@ -41,10 +212,33 @@ func RoundRobin(endpoints []string) Endpoint {
 	}
 }
 
+// random is a private source of randomness that, unlike the global source,
+// does not need to be seeded by the package.
+var random = newLockedRand()
+
 func Random(endpoints []string) Endpoint {
-	rand.Seed(time.Now().Unix())
 	return func(_ uint) string {
-		return endpoints[rand.Intn(len(endpoints))]
+		return endpoints[random.Int63n(int64(len(endpoints)))]
+	}
+}
+
+// Shuffle returns a selector that shuffles the endpoints once per strategy
+// and then walks the resulting permutation, i.e. no endpoint is tried twice
+// before all endpoints have been tried. A private source of randomness is
+// used if r is nil. Pass a seeded *rand.Rand for reproducible permutations.
+func Shuffle(r Rand) Selector {
+	r = ensureRand(r)
+	return func(endpoints []string) Endpoint {
+		perm := make([]string, len(endpoints))
+		copy(perm, endpoints)
+
+		// Fisher-Yates
+		for i := len(perm) - 1; i > 0; i-- {
+			j := int(r.Int63n(int64(i + 1)))
+			perm[i], perm[j] = perm[j], perm[i]
+		}
+
+		return RoundRobin(perm)
 	}
 }
 
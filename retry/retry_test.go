@@ -3,6 +3,8 @@ package retry_test
 import (
 	"errors"
 	"math"
+	"math/rand"
+	"os"
 	"strings"
 	"testing"
 	"time"
@@ -70,6 +72,172 @@ var _ = Describe("retry", func() {
 				Expect(retries).To(Equal(limit))
 			})
 
+			It("honours delays requested by the action", func() {
+				var (
+					attempts  int
+					requested = 20 * time.Millisecond
+
+					strategy = retry.NewStrategy(
+						retry.RoundRobin([]string{"one"}),
+						retry.MaxRetries(3),
+						retry.NoDelay(),
+					)
+
+					action = func(_ string) error {
+						attempts++
+						if attempts == 1 {
+							return retry.After(someErr, requested)
+						}
+						return nil
+					}
+				)
+
+				start := time.Now()
+				err := strategy.Apply(action)
+
+				Expect(err).ToNot(HaveOccurred())
+				Expect(attempts).To(Equal(2))
+				Expect(time.Since(start)).To(BeNumerically(">=", requested))
+			})
+
+			It("does not delay attempts against other endpoints", func() {
+				var (
+					tried []string
+
+					strategy = retry.NewStrategy(
+						retry.RoundRobin([]string{"one", "two"}),
+						retry.MaxRetries(3),
+						retry.NoDelay(),
+					)
+				)
+
+				start := time.Now()
+				err := strategy.Apply(func(endpoint string) error {
+					tried = append(tried, endpoint)
+					if endpoint == "one" {
+						return retry.After(someErr, time.Hour)
+					}
+					return nil
+				})
+
+				Expect(err).ToNot(HaveOccurred())
+				Expect(tried).To(Equal([]string{"one", "two"}))
+				Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+			})
+
+			It("returns the error wrapped by a requested delay", func() {
+				var (
+					strategy = retry.NewStrategy(
+						retry.RoundRobin([]string{"one"}),
+						retry.MaxRetries(1),
+						retry.NoDelay(),
+					)
+
+					err = strategy.Apply(func(_ string) error {
+						return retry.After(someErr, time.Millisecond)
+					})
+				)
+
+				Expect(err).To(MatchError(someErr.Error()))
+
+				var after *retry.AfterError
+				Expect(errors.As(err, &after)).To(BeTrue())
+				Expect(after.Err).To(Equal(someErr))
+			})
+
+			It("notifies observers before and after each attempt", func() {
+				var (
+					observer = new(recordingObserver)
+					strategy = retry.NewStrategy(
+						retry.RoundRobin([]string{"one", "two"}),
+						retry.MaxRetries(3),
+						retry.ConstantDelay(5*time.Millisecond),
+						observer,
+					)
+				)
+
+				err := strategy.Apply(func(_ string) error {
+					time.Sleep(time.Millisecond)
+					return someErr
+				})
+
+				Expect(err).To(MatchError(someErr))
+				Expect(observer.before).To(HaveLen(3))
+				Expect(observer.after).To(HaveLen(3))
+
+				for i, a := range observer.after {
+					Expect(a.Number).To(Equal(uint(i)))
+					Expect(a.Endpoint).To(Equal([]string{"one", "two"}[i%2]))
+					Expect(a.Duration).To(BeNumerically(">=", time.Millisecond))
+					Expect(a.Err).To(MatchError(someErr))
+
+					Expect(observer.before[i].Number).To(Equal(a.Number))
+					Expect(observer.before[i].Endpoint).To(Equal(a.Endpoint))
+					Expect(observer.before[i].Delay).To(Equal(a.Delay))
+					Expect(observer.before[i].Err).ToNot(HaveOccurred())
+				}
+
+				Expect(observer.after[0].Delay).To(Equal(time.Duration(0)))
+				Expect(observer.after[1].Delay).To(Equal(5 * time.Millisecond))
+			})
+
+			It("returns an aggregate error listing all attempts", func() {
+				var (
+					otherErr = errors.New("other error")
+					errs     = []error{someErr, otherErr, someErr}
+					attempt  = 0
+
+					strategy = retry.NewStrategy(
+						retry.RoundRobin([]string{"one", "two", "three"}),
+						retry.MaxRetries(3),
+						retry.NoDelay(),
+					)
+				)
+
+				err := strategy.Apply(func(_ string) error {
+					defer func() { attempt++ }()
+					return errs[attempt]
+				})
+
+				var aggregate *retry.AttemptsError
+				Expect(errors.As(err, &aggregate)).To(BeTrue())
+				Expect(aggregate.Attempts).To(HaveLen(3))
+				Expect(aggregate.Last()).To(Equal(someErr))
+
+				for i, a := range aggregate.Attempts {
+					Expect(a.Endpoint).To(Equal([]string{"one", "two", "three"}[i]))
+					Expect(a.Err).To(Equal(errs[i]))
+				}
+
+				Expect(errors.Is(err, someErr)).To(BeTrue())
+				Expect(errors.Is(err, otherErr)).To(BeTrue())
+				Expect(err).To(MatchError("3 attempts failed: one: some error; two: other error; three: some error"))
+			})
+
+			It("prints repeated errors only once", func() {
+				strategy := retry.NewStrategy(retry.RoundRobin([]string{"one"}), retry.MaxRetries(2), retry.NoDelay())
+
+				err := strategy.Apply(func(_ string) error { return someErr })
+				Expect(err).To(MatchError("some error (2 attempts)"))
+
+				strategy = retry.NewStrategy(retry.RoundRobin([]string{"one"}), retry.NoRetries(), retry.NoDelay())
+
+				err = strategy.Apply(func(_ string) error { return someErr })
+				Expect(err).To(MatchError("some error"))
+			})
+
+			It("supports errors.As for the errors of all attempts", func() {
+				strategy := retry.NewStrategy(retry.RoundRobin([]string{"one"}), retry.MaxRetries(2), retry.NoDelay())
+
+				err := strategy.Apply(func(_ string) error {
+					return &os.PathError{Op: "open", Path: "file", Err: someErr}
+				})
+
+				var pathErr *os.PathError
+				Expect(errors.As(err, &pathErr)).To(BeTrue())
+				Expect(pathErr.Path).To(Equal("file"))
+			})
+
 			It("follows the right strategy", func() {
 				var (
 					delayCalled    bool
@@ -109,6 +277,176 @@ var _ = Describe("retry", func() {
 		})
 	})
 
+	Describe(".NewStatefulStrategy", func() {
+		It("passes the state of the retries", func() {
+			var (
+				states  []retry.State
+				someErr = errors.New("some error")
+
+				strategy = retry.NewStatefulStrategy(
+					retry.RoundRobin([]string{"one"}),
+					func(s retry.State) bool {
+						states = append(states, s)
+						return s.Attempt < 3
+					},
+					func(s retry.State) time.Duration {
+						return 5 * time.Millisecond
+					},
+				)
+			)
+
+			err := strategy.Apply(func(_ string) error {
+				return someErr
+			})
+
+			Expect(err).To(MatchError(someErr))
+			Expect(states).To(HaveLen(4))
+
+			Expect(states[0].Attempt).To(Equal(uint(0)))
+			Expect(states[0].Err).ToNot(HaveOccurred())
+			Expect(states[0].PreviousDelay).To(BeZero())
+
+			for i := 1; i < len(states); i++ {
+				Expect(states[i].Attempt).To(Equal(uint(i)))
+				Expect(states[i].Err).To(MatchError(someErr))
+				Expect(states[i].PreviousDelay).To(Equal(5 * time.Millisecond))
+				Expect(states[i].Elapsed).To(BeNumerically(">", states[i-1].Elapsed))
+			}
+		})
+
+		It("stops retrying once the maximum time has elapsed", func() {
+			var (
+				attempts int
+
+				strategy = retry.NewStatefulStrategy(
+					retry.RoundRobin([]string{"one"}),
+					retry.AllOf(retry.MaxRetries(100).Stateful(), retry.MaxElapsed(50*time.Millisecond)),
+					retry.ConstantDelay(20*time.Millisecond).Stateful(),
+				)
+			)
+
+			strategy.Apply(func(_ string) error {
+				attempts++
+				return errors.New("some error")
+			})
+
+			Expect(attempts).To(BeNumerically(">=", 2))
+			Expect(attempts).To(BeNumerically("<=", 4))
+		})
+
+		It("does not wait past the maximum time", func() {
+			var (
+				attempts int
+
+				strategy = retry.NewStatefulStrategy(
+					retry.RoundRobin([]string{"one"}),
+					retry.AllOf(retry.MaxRetries(5).Stateful(), retry.MaxElapsed(50*time.Millisecond)),
+					retry.NoDelay().Stateful(),
+				)
+			)
+
+			start := time.Now()
+			err := strategy.Apply(func(_ string) error {
+				attempts++
+				return retry.After(errors.New("some error"), time.Second)
+			})
+
+			Expect(err).To(HaveOccurred())
+			Expect(attempts).To(Equal(1))
+			Expect(time.Since(start)).To(BeNumerically("<", 50*time.Millisecond))
+		})
+	})
+
+	Describe(".Combinators", func() {
+		var (
+			yes retry.StatefulAllow = func(_ retry.State) bool { return true }
+			no  retry.StatefulAllow = func(_ retry.State) bool { return false }
+		)
+
+		Describe(".AllOf", func() {
+			It("allows only if all allowances allow", func() {
+				Expect(retry.AllOf()(retry.State{})).To(BeTrue())
+				Expect(retry.AllOf(yes, yes)(retry.State{})).To(BeTrue())
+				Expect(retry.AllOf(yes, no)(retry.State{})).To(BeFalse())
+				Expect(retry.AllOf(no, no)(retry.State{})).To(BeFalse())
+			})
+
+			It("combines attempt and time limits", func() {
+				allow := retry.AllOf(retry.MaxRetries(5).Stateful(), retry.MaxElapsed(20*time.Second))
+
+				Expect(allow(retry.State{Attempt: 4, Elapsed: 19 * time.Second})).To(BeTrue())
+				Expect(allow(retry.State{Attempt: 5, Elapsed: 19 * time.Second})).To(BeFalse())
+				Expect(allow(retry.State{Attempt: 4, Elapsed: 20 * time.Second})).To(BeFalse())
+				Expect(allow(retry.State{Attempt: 4, Elapsed: 19 * time.Second, Delay: 8 * time.Second})).To(BeFalse())
+			})
+		})
+
+		Describe(".AnyOf", func() {
+			It("allows if any allowance allows", func() {
+				Expect(retry.AnyOf()(retry.State{})).To(BeFalse())
+				Expect(retry.AnyOf(yes, yes)(retry.State{})).To(BeTrue())
+				Expect(retry.AnyOf(no, yes)(retry.State{})).To(BeTrue())
+				Expect(retry.AnyOf(no, no)(retry.State{})).To(BeFalse())
+			})
+		})
+
+		Describe(".MaxElapsed", func() {
+			It("allows attempts until the given time has elapsed", func() {
+				allow := retry.MaxElapsed(time.Second)
+
+				Expect(allow(retry.State{Elapsed: 0})).To(BeTrue())
+				Expect(allow(retry.State{Elapsed: 999 * time.Millisecond})).To(BeTrue())
+				Expect(allow(retry.State{Elapsed: time.Second})).To(BeFalse())
+			})
+
+			It("takes the upcoming delay into account", func() {
+				allow := retry.MaxElapsed(time.Second)
+
+				Expect(allow(retry.State{Elapsed: 500 * time.Millisecond, Delay: 499 * time.Millisecond})).To(BeTrue())
+				Expect(allow(retry.State{Elapsed: 500 * time.Millisecond, Delay: 500 * time.Millisecond})).To(BeFalse())
+			})
+		})
+
+		Describe(".Cap", func() {
+			It("limits the delay", func() {
+				delay := retry.Cap(retry.ExponentialBackoff(time.Second).Stateful(), 8*time.Second)
+
+				Expect(delay(retry.State{Attempt: 2})).To(Equal(4 * time.Second))
+				Expect(delay(retry.State{Attempt: 3})).To(Equal(8 * time.Second))
+				Expect(delay(retry.State{Attempt: 10})).To(Equal(8 * time.Second))
+			})
+		})
+
+		Describe(".Then", func() {
+			It("switches to the next delay after the given number of attempts", func() {
+				delay := retry.Then(
+					retry.Cap(retry.ExponentialBackoff(time.Second).Stateful(), 8*time.Second),
+					3,
+					retry.ConstantDelay(5*time.Second).Stateful(),
+				)
+
+				Expect(delay(retry.State{Attempt: 0})).To(Equal(1 * time.Second))
+				Expect(delay(retry.State{Attempt: 1})).To(Equal(2 * time.Second))
+				Expect(delay(retry.State{Attempt: 2})).To(Equal(4 * time.Second))
+				Expect(delay(retry.State{Attempt: 3})).To(Equal(5 * time.Second))
+				Expect(delay(retry.State{Attempt: 10})).To(Equal(5 * time.Second))
+			})
+		})
+
+		Describe(".Stateful", func() {
+			It("passes the attempt to the underlying function", func() {
+				var (
+					allow = retry.MaxRetries(2).Stateful()
+					delay = retry.LinearBackoff(time.Second).Stateful()
+				)
+
+				Expect(allow(retry.State{Attempt: 1})).To(BeTrue())
+				Expect(allow(retry.State{Attempt: 2})).To(BeFalse())
+				Expect(delay(retry.State{Attempt: 3})).To(Equal(3 * time.Second))
+			})
+		})
+	})
+
 	Describe(".Endpoint", func() {
 		var endpoints = []string{"one", "two", "three"}
 
@@ -142,6 +480,57 @@ var _ = Describe("retry", func() {
 		})
 	})
 
+	Describe(".Shuffle", func() {
+		var endpoints = []string{"one", "two", "three", "four", "five"}
+
+		It("tries every endpoint once before repeating", func() {
+			endpoint := retry.Shuffle(nil)(endpoints)
+
+			seen := map[string]bool{}
+			for i := uint(0); i < uint(len(endpoints)); i++ {
+				seen[endpoint(i)] = true
+			}
+			Expect(seen).To(HaveLen(len(endpoints)))
+
+			for i := uint(0); i < 100; i++ {
+				Expect(endpoint(i + 1)).ToNot(Equal(endpoint(i)))
+				Expect(endpoint(i + uint(len(endpoints)))).To(Equal(endpoint(i)))
+			}
+		})
+
+		It("does not modify the given endpoints", func() {
+			given := []string{"one", "two", "three", "four", "five"}
+			retry.Shuffle(nil)(given)
+			Expect(given).To(Equal(endpoints))
+		})
+
+		It("returns the same permutations for the same seed", func() {
+			a := retry.Shuffle(rand.New(rand.NewSource(42)))
+			b := retry.Shuffle(rand.New(rand.NewSource(42)))
+
+			for n := 0; n < 10; n++ {
+				x, y := a(endpoints), b(endpoints)
+				for i := uint(0); i < uint(len(endpoints)); i++ {
+					Expect(x(i)).To(Equal(y(i)))
+				}
+			}
+		})
+
+		It("shuffles the endpoints anew for every strategy", func() {
+			selector := retry.Shuffle(rand.New(rand.NewSource(42)))
+
+			first := map[string]int{}
+			for n := 0; n < 1000; n++ {
+				first[selector(endpoints)(0)]++
+			}
+
+			Expect(first).To(HaveLen(len(endpoints)))
+			for _, e := range endpoints {
+				Expect(first[e]).To(BeNumerically("~", 200, 60))
+			}
+		})
+	})
+
 	Describe(".Allow", func() {
 		Describe(".NoRetries", func() {
 			It("always returns false except for the first attempt", func() {
@@ -225,5 +614,159 @@ var _ = Describe("retry", func() {
 				}
 			})
 		})
+
+		Describe(".FullJitter", func() {
+			var (
+				base = 100 * time.Millisecond
+				max  = 2 * time.Second
+			)
+
+			It("does not delay the first attempt", func() {
+				delay := retry.FullJitter(base, max, nil)
+				Expect(delay(0)).To(Equal(time.Duration(0)))
+			})
+
+			It("returns capped exponential delays for the largest random value", func() {
+				delay := retry.FullJitter(base, max, maxRand{})
+
+				expected := []time.Duration{
+					100 * time.Millisecond,
+					200 * time.Millisecond,
+					400 * time.Millisecond,
+					800 * time.Millisecond,
+					1600 * time.Millisecond,
+					2 * time.Second,
+					2 * time.Second,
+				}
+
+				for i, want := range expected {
+					Expect(delay(uint(i + 1))).To(Equal(want))
+				}
+
+				Expect(delay(1000)).To(Equal(max))
+			})
+
+			It("returns zero for the smallest random value", func() {
+				delay := retry.FullJitter(base, max, minRand{})
+
+				for i := uint(1); i < 10; i++ {
+					Expect(delay(i)).To(Equal(time.Duration(0)))
+				}
+			})
+
+			It("is deterministic for a seeded source", func() {
+				a := retry.FullJitter(base, max, rand.New(rand.NewSource(42)))
+				b := retry.FullJitter(base, max, rand.New(rand.NewSource(42)))
+
+				for i := uint(1); i < 100; i++ {
+					d := a(i)
+					Expect(d).To(Equal(b(i)))
+					Expect(d).To(BeNumerically(">=", 0))
+					Expect(d).To(BeNumerically("<=", max))
+				}
+			})
+		})
+
+		Describe(".EqualJitter", func() {
+			var (
+				base = 100 * time.Millisecond
+				max  = 2 * time.Second
+			)
+
+			It("does not delay the first attempt", func() {
+				delay := retry.EqualJitter(base, max, nil)
+				Expect(delay(0)).To(Equal(time.Duration(0)))
+			})
+
+			It("keeps half of the capped exponential delay", func() {
+				lower := retry.EqualJitter(base, max, minRand{})
+				upper := retry.EqualJitter(base, max, maxRand{})
+
+				expected := []time.Duration{
+					100 * time.Millisecond,
+					200 * time.Millisecond,
+					400 * time.Millisecond,
+					800 * time.Millisecond,
+					1600 * time.Millisecond,
+					2 * time.Second,
+				}
+
+				for i, want := range expected {
+					Expect(lower(uint(i + 1))).To(Equal(want / 2))
+					Expect(upper(uint(i + 1))).To(Equal(want))
+				}
+			})
+
+			It("is deterministic for a seeded source", func() {
+				a := retry.EqualJitter(base, max, rand.New(rand.NewSource(42)))
+				b := retry.EqualJitter(base, max, rand.New(rand.NewSource(42)))
+
+				for i := uint(1); i < 100; i++ {
+					Expect(a(i)).To(Equal(b(i)))
+				}
+			})
+		})
+
+		Describe(".DecorrelatedJitter", func() {
+			var (
+				base = 100 * time.Millisecond
+				max  = 2 * time.Second
+			)
+
+			It("does not delay the first attempt", func() {
+				delay := retry.DecorrelatedJitter(base, max, nil)
+				Expect(delay(retry.State{})).To(Equal(time.Duration(0)))
+			})
+
+			It("returns the base delay for the smallest random value", func() {
+				delay := retry.DecorrelatedJitter(base, max, minRand{})
+
+				for _, prev := range []time.Duration{0, base, time.Second, max} {
+					Expect(delay(retry.State{Attempt: 3, PreviousDelay: prev})).To(Equal(base))
+				}
+			})
+
+			It("triples the previous delay up to the cap for the largest random value", func() {
+				delay := retry.DecorrelatedJitter(base, max, maxRand{})
+
+				Expect(delay(retry.State{Attempt: 1})).To(Equal(300 * time.Millisecond))
+				Expect(delay(retry.State{Attempt: 2, PreviousDelay: 300 * time.Millisecond})).To(Equal(900 * time.Millisecond))
+				Expect(delay(retry.State{Attempt: 3, PreviousDelay: 900 * time.Millisecond})).To(Equal(max))
+				Expect(delay(retry.State{Attempt: 3, PreviousDelay: 500 * time.Millisecond})).To(Equal(1500 * time.Millisecond))
+			})
+
+			It("stays within bounds for a seeded source", func() {
+				var (
+					a = retry.DecorrelatedJitter(base, max, rand.New(rand.NewSource(42)))
+					b = retry.DecorrelatedJitter(base, max, rand.New(rand.NewSource(42)))
+					d time.Duration
+				)
+
+				for i := uint(1); i < 100; i++ {
+					state := retry.State{Attempt: i, PreviousDelay: d}
+					d = a(state)
+					Expect(d).To(Equal(b(state)))
+					Expect(d).To(BeNumerically(">=", base))
+					Expect(d).To(BeNumerically("<=", max))
+				}
+			})
+		})
 	})
 })
+
+type minRand struct{}
+
+func (minRand) Int63n(n int64) int64 { return 0 }
+
+type maxRand struct{}
+
+func (maxRand) Int63n(n int64) int64 { return n - 1 }
+
+type recordingObserver struct {
+	before []retry.Attempt
+	after  []retry.Attempt
+}
+
+func (o *recordingObserver) Before(a retry.Attempt) { o.before = append(o.before, a) }
+
+func (o *recordingObserver) After(a retry.Attempt) { o.after = append(o.after, a) }
@@ -0,0 +1,158 @@
+package eureka
+
+import (
+	"errors"
+	"os"
+	ossignal "os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// DefaultDrainPeriod defines how long an instance stays out of service before
+// it is deregistered. It matches the default interval at which watchers
+// refresh, i.e. consumers stop routing to the instance in the meantime.
+const DefaultDrainPeriod = DefaultPollInterval
+
+// ErrShutdownDeadline is returned if the deadline of a shutdown passed while
+// the instance was being drained. The instance is deregistered nevertheless.
+var ErrShutdownDeadline = errors.New("Shutdown deadline exceeded")
+
+// ShutdownOption configures a shutdown.
+type ShutdownOption func(*shutdown)
+
+// ShutdownDrain defines how long the instance stays out of service before it
+// is deregistered, DefaultDrainPeriod by default. Set it to the interval at
+// which consumers refresh their view of the registry.
+func ShutdownDrain(period time.Duration) ShutdownOption {
+	return func(s *shutdown) {
+		s.drain = period
+	}
+}
+
+// ShutdownDeadline limits the time a shutdown may take until the instance is
+// being deregistered. Once the deadline has passed, taking the instance out of
+// service or draining it is abandoned, the instance is deregistered right
+// away and the shutdown returns ErrShutdownDeadline. The deregistration itself
+// is not bounded by the deadline, it is retried according to the retry policy
+// of the client. There is no deadline by default.
+func ShutdownDeadline(deadline time.Duration) ShutdownOption {
+	return func(s *shutdown) {
+		s.deadline = deadline
+	}
+}
+
+// ShutdownHealthReporter stops the given reporter before the instance is
+// taken out of service. Otherwise, a reporter that observes the instance
+// recover while it is being drained puts it back in service.
+func ShutdownHealthReporter(reporter *HealthReporter) ShutdownOption {
+	return func(s *shutdown) {
+		s.reporter = reporter
+	}
+}
+
+// ShutdownSignals defines the signals that trigger a shutdown in
+// ShutdownOnSignal, SIGTERM and SIGINT by default.
+func ShutdownSignals(signals ...os.Signal) ShutdownOption {
+	return func(s *shutdown) {
+		s.signals = signals
+	}
+}
+
+type shutdown struct {
+	drain    time.Duration
+	deadline time.Duration
+	signals  []os.Signal
+	reporter *HealthReporter
+}
+
+func newShutdown(options []ShutdownOption) *shutdown {
+	s := &shutdown{
+		drain:   DefaultDrainPeriod,
+		signals: []os.Signal{syscall.SIGTERM, os.Interrupt},
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	return s
+}
+
+// Shutdown takes the instance out of service, waits for the drain period to
+// let consumers notice, and deregisters it. If the instance cannot be taken
+// out of service, it is deregistered right away. A HealthReporter of the
+// instance must be stopped first, see ShutdownHealthReporter.
+func Shutdown(client API, instance *Instance, options ...ShutdownOption) error {
+	return newShutdown(options).run(client, instance, nil)
+}
+
+// ShutdownOnSignal blocks until one of the shutdown signals is received or
+// the context is done, then shuts down the instance like Shutdown. Another
+// signal received while draining cuts the drain period short.
+func ShutdownOnSignal(ctx context.Context, client API, instance *Instance, options ...ShutdownOption) error {
+	s := newShutdown(options)
+
+	signals := make(chan os.Signal, 1)
+	ossignal.Notify(signals, s.signals...)
+	defer ossignal.Stop(signals)
+
+	return s.onSignal(ctx, client, instance, signals)
+}
+
+// onSignal waits for a value from signals or for the context to be done, then
+// shuts down the instance. Further values cut the drain period short.
+func (s *shutdown) onSignal(ctx context.Context, client API, instance *Instance, signals <-chan os.Signal) error {
+	select {
+	case <-signals:
+	case <-ctx.Done():
+	}
+
+	return s.run(client, instance, signals)
+}
+
+// run takes the instance out of service, drains it and deregisters it. The
+// drain period ends early if interrupt receives a value, taking the instance
+// out of service and draining it end early if the deadline passes. The
+// instance is deregistered before run returns in either case.
+func (s *shutdown) run(client API, instance *Instance, interrupt <-chan os.Signal) error {
+	var expired <-chan time.Time
+	if s.deadline > 0 {
+		deadline := time.NewTimer(s.deadline)
+		defer deadline.Stop()
+		expired = deadline.C
+	}
+
+	if s.reporter != nil {
+		s.reporter.Stop()
+	}
+
+	// the override is retried according to the retry policy of the client,
+	// which must not hold up the deregistration past the deadline
+	override := make(chan error, 1)
+	go func() {
+		override <- client.StatusOverride(instance, StatusOutOfService)
+	}()
+
+	var err error
+	select {
+	case err = <-override:
+	case <-expired:
+		err = ErrShutdownDeadline
+	}
+
+	if err == nil {
+		drain := time.NewTimer(s.drain)
+		defer drain.Stop()
+
+		select {
+		case <-drain.C:
+		case <-interrupt:
+		case <-expired:
+			err = ErrShutdownDeadline
+		}
+	}
+
+	return errors.Join(err, client.Deregister(instance))
+}
@@ -0,0 +1,192 @@
+package eureka_test
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/st3v/go-eureka"
+	"github.com/st3v/go-eureka/fake"
+)
+
+var _ = Describe("Shutdown", func() {
+	var (
+		client   *fake.Client
+		instance *eureka.Instance
+		done     chan error
+	)
+
+	status := func() eureka.Status {
+		i, err := client.AppInstance(instance.AppName, instance.ID)
+		if err != nil {
+			return eureka.StatusUnknown
+		}
+		return i.Status
+	}
+
+	deregistered := func() bool {
+		_, err := client.AppInstance(instance.AppName, instance.ID)
+		return errors.Is(err, eureka.ErrNotFound)
+	}
+
+	BeforeEach(func() {
+		client = fake.NewClient()
+		instance = &eureka.Instance{
+			ID:      "one",
+			AppName: "app",
+			Status:  eureka.StatusUp,
+		}
+		Expect(client.Register(instance)).To(Succeed())
+
+		done = make(chan error, 1)
+	})
+
+	It("takes the instance out of service before deregistering it", func() {
+		go func(done chan<- error) {
+			done <- eureka.Shutdown(client, instance, eureka.ShutdownDrain(100*time.Millisecond))
+		}(done)
+
+		Eventually(status).Should(Equal(eureka.StatusOutOfService))
+		Consistently(deregistered, 50*time.Millisecond).Should(BeFalse())
+
+		Eventually(done).Should(Receive(BeNil()))
+		Expect(deregistered()).To(BeTrue())
+	})
+
+	It("deregisters right away if the instance cannot be taken out of service", func() {
+		Expect(client.Deregister(instance)).To(Succeed())
+
+		err := eureka.Shutdown(client, instance, eureka.ShutdownDrain(time.Hour))
+		Expect(errors.Is(err, fake.ErrInstanceNotFound)).To(BeTrue())
+	})
+
+	It("deregisters the instance before the deadline", func() {
+		err := eureka.Shutdown(client, instance,
+			eureka.ShutdownDrain(time.Hour),
+			eureka.ShutdownDeadline(50*time.Millisecond),
+		)
+
+		Expect(errors.Is(err, eureka.ErrShutdownDeadline)).To(BeTrue())
+		Expect(deregistered()).To(BeTrue())
+	})
+
+	It("does not wait for the instance to be taken out of service past the deadline", func() {
+		block := make(chan struct{})
+		defer close(block)
+
+		err := eureka.Shutdown(&blockingClient{client, block}, instance,
+			eureka.ShutdownDrain(time.Hour),
+			eureka.ShutdownDeadline(50*time.Millisecond),
+		)
+
+		Expect(errors.Is(err, eureka.ErrShutdownDeadline)).To(BeTrue())
+		Expect(deregistered()).To(BeTrue())
+	})
+
+	It("stops the health reporter before taking the instance out of service", func() {
+		var healthy atomic.Bool
+		reporter := eureka.NewHealthReporter(client, instance, func(context.Context) eureka.Status {
+			if healthy.Load() {
+				return eureka.StatusUp
+			}
+			return eureka.StatusDown
+		}, time.Millisecond, eureka.HealthThresholds(1, 1))
+		defer reporter.Stop()
+
+		Eventually(status).Should(Equal(eureka.StatusDown))
+
+		go func(done chan<- error) {
+			done <- eureka.Shutdown(client, instance,
+				eureka.ShutdownDrain(200*time.Millisecond),
+				eureka.ShutdownHealthReporter(reporter),
+			)
+		}(done)
+
+		Eventually(status).Should(Equal(eureka.StatusOutOfService))
+
+		// the instance recovers while being drained
+		healthy.Store(true)
+		Consistently(status, 100*time.Millisecond).Should(Equal(eureka.StatusOutOfService))
+
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	Describe("ShutdownOnSignal", func() {
+		var (
+			ctx     context.Context
+			cancel  context.CancelFunc
+			signals chan os.Signal
+		)
+
+		signal := func() {
+			signals <- syscall.SIGTERM
+		}
+
+		start := func(drain time.Duration) {
+			go func(ctx context.Context, signals <-chan os.Signal, done chan<- error) {
+				done <- eureka.ShutdownOnSignals(ctx, client, instance, signals, eureka.ShutdownDrain(drain))
+			}(ctx, signals, done)
+		}
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+			signals = make(chan os.Signal)
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("shuts down once a signal is received", func() {
+			start(50 * time.Millisecond)
+
+			Consistently(status, 50*time.Millisecond).Should(Equal(eureka.StatusUp))
+
+			signal()
+			Eventually(status).Should(Equal(eureka.StatusOutOfService))
+			Eventually(done).Should(Receive(BeNil()))
+			Expect(deregistered()).To(BeTrue())
+		})
+
+		It("shuts down once the context is done", func() {
+			start(50 * time.Millisecond)
+
+			cancel()
+
+			Eventually(status).Should(Equal(eureka.StatusOutOfService))
+			Eventually(done).Should(Receive(BeNil()))
+			Expect(deregistered()).To(BeTrue())
+		})
+
+		It("cuts the drain period short on another signal", func() {
+			start(time.Hour)
+
+			signal()
+
+			Eventually(status).Should(Equal(eureka.StatusOutOfService))
+			Consistently(deregistered, 50*time.Millisecond).Should(BeFalse())
+
+			signal()
+			Eventually(done).Should(Receive(BeNil()))
+			Expect(deregistered()).To(BeTrue())
+		})
+	})
+})
+
+// blockingClient blocks status overrides until block is closed.
+type blockingClient struct {
+	eureka.API
+	block chan struct{}
+}
+
+func (c *blockingClient) StatusOverride(instance *eureka.Instance, status eureka.Status) error {
+	<-c.block
+	return c.API.StatusOverride(instance, status)
+}
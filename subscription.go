@@ -0,0 +1,258 @@
+package eureka
+
+import (
+	"sort"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Subscription receives the events observed by a Watcher. Every subscription
+// has its own filters and buffer, see Watcher.Subscribe.
+type Subscription struct {
+	filter
+	watcher  *Watcher
+	events   chan Event
+	callback func(Event)
+	batches  chan Batch
+	window   time.Duration
+	maxDelay time.Duration
+	flapping time.Duration
+	queue    *eventQueue
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// Subscribe adds a subscriber to the watcher without polling the registry
+// any more often. The subscription starts out with EventInstanceRegistered
+// events for all instances currently known to the watcher, followed by the
+// changes the watcher observes from there on.
+//
+// The WatchBuffer, WatchOverflow, WatchFlapping, WatchBatchMaxDelay,
+// WatchApps, WatchVIPs and WatchFilter options configure the subscription,
+// other options are ignored.
+// Filters restrict the subscription further than the filters of the watcher.
+func (w *Watcher) Subscribe(options ...WatchOption) *Subscription {
+	s := w.newSubscription(subscriptionConfig(options))
+	s.events = make(chan Event)
+	return w.subscribe(s)
+}
+
+// SubscribeFunc adds a subscriber to the watcher that gets invoked for every
+// event, see Subscribe. Events are delivered one at a time from a dedicated
+// goroutine. The callback may subscribe to the same watcher, but it must not
+// cancel its own subscription or stop the watcher, since both wait for the
+// callback to return. Do so from another goroutine instead.
+func (w *Watcher) SubscribeFunc(callback func(Event), options ...WatchOption) *Subscription {
+	s := w.newSubscription(subscriptionConfig(options))
+	s.callback = callback
+	return w.subscribe(s)
+}
+
+func subscriptionConfig(options []WatchOption) *Watcher {
+	c := &Watcher{}
+	for _, opt := range options {
+		opt(c)
+	}
+	return c
+}
+
+func (w *Watcher) newSubscription(c *Watcher) *Subscription {
+	ctx, cancel := context.WithCancel(w.ctx)
+
+	s := &Subscription{
+		filter:   c.filter,
+		watcher:  w,
+		flapping: c.flapping,
+		maxDelay: c.batchMaxDelay,
+		queue:    newEventQueue(c.buffer, c.overflow),
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+
+	s.queue.classify = w.updateType
+
+	return s
+}
+
+// subscribe starts delivering events to the given subscription.
+func (w *Watcher) subscribe(s *Subscription) *Subscription {
+	w.subMtx.Lock()
+	defer w.subMtx.Unlock()
+
+	// the current state, ordered by app
+	var (
+		snapshot = w.Snapshot()
+		apps     = make([]string, 0, len(snapshot))
+		initial  []queuedEvent
+	)
+
+	for app := range snapshot {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+
+	for _, app := range apps {
+		for _, i := range snapshot[app] {
+			if s.matches(app, i) {
+				initial = append(initial, queuedEvent{key: key(app, i), event: Event{EventInstanceRegistered, i, nil}})
+			}
+		}
+	}
+
+	s.queue.prime(initial)
+
+	w.subs = append(w.subs, s)
+
+	go s.deliver()
+
+	return s
+}
+
+// Events returns the channel the subscription receives events on. The
+// channel is closed when the subscription is cancelled or the watcher stops.
+// It returns nil for subscriptions created by SubscribeFunc or
+// SubscribeBatches.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Cancel ends the subscription. Buffered events are discarded. The Events()
+// channel is closed and no more callbacks are running once Cancel returns.
+func (s *Subscription) Cancel() {
+	s.cancel()
+	<-s.done
+
+	w := s.watcher
+	w.subMtx.Lock()
+	defer w.subMtx.Unlock()
+
+	for n, sub := range w.subs {
+		if sub == s {
+			w.subs = append(w.subs[:n:n], w.subs[n+1:]...)
+			return
+		}
+	}
+}
+
+// publish adds an event to the subscription. Updates that make an instance
+// match or stop matching the filters of the subscription are being published
+// as registrations and deregistrations respectively.
+func (s *Subscription) publish(appName, key string, e Event) {
+	if e.Instance == nil {
+		// warnings concern all subscriptions
+		s.queue.push(s.ctx, key, e)
+		return
+	}
+
+	var before, after bool
+
+	switch e.Type {
+	case EventInstanceRegistered:
+		after = s.matches(appName, e.Instance)
+	case EventInstanceDeregistered, EventInstanceLeaseExpired:
+		before = s.matches(appName, e.Instance)
+	default:
+		before, after = s.matches(appName, e.Previous), s.matches(appName, e.Instance)
+	}
+
+	switch {
+	case before && after:
+	case after:
+		e = Event{EventInstanceRegistered, e.Instance, nil}
+	case before && e.Previous != nil:
+		e = Event{EventInstanceDeregistered, e.Previous, nil}
+	case before:
+	default:
+		return
+	}
+
+	// blocks depending on the overflow policy, gives up once cancelled
+	s.queue.push(s.ctx, key, e)
+}
+
+// deliver forwards buffered events to the Events() channel, the callback or
+// the Batches() channel of the subscription. Events are kept pending while
+// they are being held back by the flapping suppressor or until a batch is
+// complete.
+func (s *Subscription) deliver() {
+	defer close(s.done)
+
+	if s.events != nil {
+		defer close(s.events)
+	}
+
+	if s.batches != nil {
+		defer close(s.batches)
+	}
+
+	var (
+		pending = newEventQueue(0, OverflowCoalesce)
+		started time.Time
+		quiet   time.Time
+	)
+
+	pending.classify = s.queue.classify
+
+	for {
+		var (
+			timeout <-chan time.Time
+			timer   *time.Timer
+		)
+
+		if deadline, ok := s.deadline(pending, quiet); ok {
+			timer = time.NewTimer(time.Until(deadline))
+			timeout = timer.C
+		}
+
+		item, ok := s.queue.next(s.ctx, timeout)
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if s.ctx.Err() != nil {
+			return
+		}
+
+		now := time.Now()
+		endOfPoll := ok && item.event.Type == eventEndOfPoll
+
+		if ok && !endOfPoll {
+			if pending.count() == 0 {
+				started = now
+			}
+
+			item.at = now
+			pending.add(item)
+
+			// events that keep arriving must not hold back a batch forever
+			quiet = now.Add(s.window)
+			if limit := started.Add(s.maxDelay); s.maxDelay > 0 && quiet.After(limit) {
+				quiet = limit
+			}
+		}
+
+		if !s.release(pending, now, quiet, endOfPoll) {
+			return
+		}
+	}
+}
+
+// send delivers a single event. It returns false if the subscription has
+// been cancelled.
+func (s *Subscription) send(e Event) bool {
+	if s.callback != nil {
+		s.callback(e)
+		return true
+	}
+
+	select {
+	case s.events <- e:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,144 @@
+package eureka
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Subscription", func() {
+	var (
+		interval = 10 * time.Millisecond
+		registry *mockRegistry
+		watcher  *Watcher
+		one, two *Instance
+	)
+
+	BeforeEach(func() {
+		one = &Instance{ID: "one", VIPAddr: "vip"}
+		two = &Instance{ID: "two"}
+
+		registry = newMockRegistry()
+		registry.Register(&App{Name: "app", Instances: []*Instance{one, two}})
+
+		watcher = NewWatcher(registry, interval)
+	})
+
+	AfterEach(func() {
+		watcher.Stop()
+	})
+
+	It("shares the poll loop of the watcher", func() {
+		registry := newMockRegistry()
+		registry.Register(&App{Name: "app", Instances: []*Instance{one, two}})
+
+		shared := NewWatcher(registry, time.Hour)
+		defer shared.Stop()
+
+		first := shared.Subscribe()
+		second := shared.Subscribe()
+
+		for _, s := range []*Subscription{first, second} {
+			Eventually(s.Events()).Should(Receive())
+			Eventually(s.Events()).Should(Receive())
+		}
+
+		Expect(registry.AppsCalls()).To(Equal(1))
+	})
+
+	It("replays the current state to late subscribers", func() {
+		Expect(watcher.WaitForSync(watcher.ctx)).To(Succeed())
+
+		s := watcher.Subscribe()
+
+		Eventually(s.Events()).Should(Receive(Equal(Event{EventInstanceRegistered, one, nil})))
+		Eventually(s.Events()).Should(Receive(Equal(Event{EventInstanceRegistered, two, nil})))
+	})
+
+	It("delivers subsequent changes", func() {
+		s := watcher.Subscribe(WatchBuffer(10))
+
+		three := &Instance{ID: "three"}
+		registry.Register(&App{Name: "app", Instances: []*Instance{one, two, three}})
+
+		Eventually(s.Events()).Should(Receive(Equal(Event{EventInstanceRegistered, three, nil})))
+	})
+
+	It("applies its own filters", func() {
+		s := watcher.Subscribe(WatchVIPs("vip"))
+		Eventually(s.Events()).Should(Receive(Equal(Event{EventInstanceRegistered, one, nil})))
+
+		// instances that start matching are reported as registered
+		changed := &Instance{ID: "two", VIPAddr: "vip"}
+		registry.Register(&App{Name: "app", Instances: []*Instance{one, changed}})
+		Eventually(s.Events()).Should(Receive(Equal(Event{EventInstanceRegistered, changed, nil})))
+
+		// instances that stop matching are reported as deregistered
+		registry.Register(&App{Name: "app", Instances: []*Instance{one, two}})
+		Eventually(s.Events()).Should(Receive(Equal(Event{EventInstanceDeregistered, changed, nil})))
+
+		Consistently(s.Events()).ShouldNot(Receive())
+	})
+
+	It("invokes callbacks", func() {
+		events := make(chan Event, 10)
+		s := watcher.SubscribeFunc(func(e Event) {
+			events <- e
+		})
+
+		Expect(s.Events()).To(BeNil())
+		Eventually(events).Should(Receive())
+		Eventually(events).Should(Receive())
+	})
+
+	It("does not hold up other subscribers once cancelled", func() {
+		idle := watcher.Subscribe()
+		active := watcher.Subscribe()
+
+		idle.Cancel()
+		Eventually(idle.Events()).Should(BeClosed())
+
+		three := &Instance{ID: "three"}
+		registry.Register(&App{Name: "app", Instances: []*Instance{one, two, three}})
+
+		Eventually(active.Events()).Should(Receive(Equal(Event{EventInstanceRegistered, three, nil})))
+	})
+
+	It("does not keep others from subscribing or cancelling while stalled", func() {
+		stalled := watcher.Subscribe()
+
+		// more events than fit into its buffer stall polling
+		three := &Instance{ID: "three"}
+		registry.Register(&App{Name: "app", Instances: []*Instance{one, two, three}})
+		calls := registry.AppsCalls()
+		Consistently(registry.AppsCalls, 5*interval).Should(BeNumerically("<=", calls+1))
+
+		subscribed := make(chan *Subscription)
+		go func() {
+			subscribed <- watcher.Subscribe()
+		}()
+
+		var late *Subscription
+		Eventually(subscribed).Should(Receive(&late))
+		Eventually(late.Events()).Should(Receive())
+
+		cancelled := make(chan struct{})
+		go func() {
+			late.Cancel()
+			close(cancelled)
+		}()
+
+		Eventually(cancelled).Should(BeClosed())
+		Eventually(stalled.Events()).Should(Receive())
+	})
+
+	It("closes all subscriptions when the watcher stops", func() {
+		s := watcher.Subscribe()
+
+		watcher.Stop()
+
+		Eventually(s.Events()).Should(BeClosed())
+		Eventually(watcher.Events()).Should(BeClosed())
+	})
+})
@@ -2,6 +2,8 @@ package eureka
 
 import (
 	"encoding/xml"
+	"net"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -24,25 +26,116 @@ type Instance struct {
 	DataCenterInfo DataCenter `xml:"dataCenterInfo"`
 	LeaseInfo      Lease      `xml:"leaseInfo"`
 	Metadata       Metadata   `xml:"metadata"`
+	ActionType     ActionType `xml:"actionType,omitempty"`
 }
 
-// Equals checks if two instances are the same. Does not compare LeaseInfo.
+// ActionType defines how an instance has changed, as reported by the delta of
+// a registry.
+type ActionType string
+
+const (
+	ActionAdded    ActionType = "ADDED"
+	ActionModified ActionType = "MODIFIED"
+	ActionDeleted  ActionType = "DELETED"
+)
+
+// Equals checks if two instances are the same. Does not compare LeaseInfo
+// and ActionType.
 func (i *Instance) Equals(other *Instance) bool {
-	return i.ID == other.ID &&
-		i.HostName == other.HostName &&
-		strings.ToUpper(i.AppName) == strings.ToUpper(other.AppName) &&
-		i.IPAddr == other.IPAddr &&
-		i.VIPAddr == other.VIPAddr &&
-		i.SecureVIPAddr == other.SecureVIPAddr &&
-		i.Status == other.Status &&
-		i.StatusOverride == other.StatusOverride &&
-		i.Port == other.Port &&
-		i.SecurePort == other.SecurePort &&
-		i.HomePageURL == other.HomePageURL &&
-		i.StatusPageURL == other.StatusPageURL &&
-		i.HealthCheckURL == other.HealthCheckURL &&
-		i.DataCenterInfo == other.DataCenterInfo &&
-		i.Metadata.Equals(other.Metadata)
+	return len(i.Diff(other)) == 0
+}
+
+// Diff returns the names of the fields that differ between two instances, in
+// the order they are declared in Instance. Like Equals, it does not compare
+// LeaseInfo and ActionType.
+func (i *Instance) Diff(other *Instance) []string {
+	var fields []string
+
+	diff := func(field string, equal bool) {
+		if !equal {
+			fields = append(fields, field)
+		}
+	}
+
+	diff("ID", i.ID == other.ID)
+	diff("HostName", i.HostName == other.HostName)
+	diff("AppName", strings.ToUpper(i.AppName) == strings.ToUpper(other.AppName))
+	diff("IPAddr", i.IPAddr == other.IPAddr)
+	diff("VIPAddr", i.VIPAddr == other.VIPAddr)
+	diff("SecureVIPAddr", i.SecureVIPAddr == other.SecureVIPAddr)
+	diff("Status", i.Status == other.Status)
+	diff("StatusOverride", i.StatusOverride == other.StatusOverride)
+	diff("Port", i.Port == other.Port)
+	diff("SecurePort", i.SecurePort == other.SecurePort)
+	diff("HomePageURL", i.HomePageURL == other.HomePageURL)
+	diff("StatusPageURL", i.StatusPageURL == other.StatusPageURL)
+	diff("HealthCheckURL", i.HealthCheckURL == other.HealthCheckURL)
+	diff("DataCenterInfo", i.DataCenterInfo == other.DataCenterInfo)
+	diff("Metadata", i.Metadata.Equals(other.Metadata))
+
+	return fields
+}
+
+// ZoneMetadataKey is the metadata key conventionally used to announce the
+// zone of an instance outside of AWS.
+const ZoneMetadataKey = "zone"
+
+// Zone returns the zone of the instance, i.e. its AWS availability zone or
+// the zone announced in its metadata.
+func (i *Instance) Zone() string {
+	if z := i.DataCenterInfo.Metadata.AvailabilityZone; z != "" {
+		return z
+	}
+
+	return i.Metadata[ZoneMetadataKey]
+}
+
+// Address returns the address requests should be sent to, i.e. the IP
+// address of the instance, or its host name if no address is set, and its
+// regular or secure port.
+func (i *Instance) Address(secure bool) string {
+	host := i.IPAddr
+	if host == "" {
+		host = i.HostName
+	}
+
+	port := i.Port
+	if secure {
+		port = i.SecurePort
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(port)))
+}
+
+// LeaseRemaining returns the time until the lease of the instance expires,
+// i.e. until the lease duration has passed since the lease was last renewed
+// or, if it has never been renewed, since the instance registered. The result
+// is negative once the lease has expired and zero if the instance does not
+// hold any lease information.
+func (i *Instance) LeaseRemaining(now time.Time) time.Duration {
+	renewed := time.Time(i.LeaseInfo.LastRenewalTime)
+	if !isSet(renewed) {
+		renewed = time.Time(i.LeaseInfo.RegistrationTime)
+	}
+
+	if i.LeaseInfo.Duration <= 0 || !isSet(renewed) {
+		return 0
+	}
+
+	return renewed.Add(time.Duration(i.LeaseInfo.Duration)).Sub(now)
+}
+
+// LeaseExpired checks if the lease of the instance has expired, see
+// LeaseRemaining. The lease of instances without lease information never
+// expires.
+func (i *Instance) LeaseExpired(now time.Time) bool {
+	return i.LeaseRemaining(now) < 0
+}
+
+// isSet checks if a timestamp has been set, the registry reports unset
+// timestamps as 0.
+func isSet(t time.Time) bool {
+	return !t.IsZero() && t.UnixNano() > 0
 }
 
 type Port uint16
@@ -80,4 +80,108 @@ var _ = Describe("Instance", func() {
 		Expect(err).ToNot(HaveOccurred())
 		Expect(actual).To(Equal(instance))
 	})
+
+	Describe("Diff", func() {
+		var other eureka.Instance
+
+		BeforeEach(func() {
+			other = instance
+			other.Metadata = map[string]string{
+				"b": "two",
+				"a": "one",
+			}
+		})
+
+		It("does not report any differences for equal instances", func() {
+			Expect(instance.Diff(&other)).To(BeEmpty())
+			Expect(instance.Equals(&other)).To(BeTrue())
+		})
+
+		It("ignores lease info and the case of app names", func() {
+			other.LeaseInfo = eureka.Lease{}
+			other.AppName = "MYAPP"
+
+			Expect(instance.Diff(&other)).To(BeEmpty())
+		})
+
+		It("lists the changed fields", func() {
+			other.Status = eureka.StatusDown
+			other.SecurePort = 8443
+			other.Metadata["a"] = "changed"
+
+			Expect(instance.Diff(&other)).To(Equal([]string{"Status", "SecurePort", "Metadata"}))
+			Expect(instance.Equals(&other)).To(BeFalse())
+		})
+	})
+
+	Describe("Zone", func() {
+		It("prefers the availability zone", func() {
+			i := &eureka.Instance{
+				DataCenterInfo: eureka.DataCenter{
+					Metadata: eureka.AmazonMetadata{AvailabilityZone: "us-east-1a"},
+				},
+				Metadata: eureka.Metadata{"zone": "zone-a"},
+			}
+
+			Expect(i.Zone()).To(Equal("us-east-1a"))
+		})
+
+		It("falls back to the zone announced in the metadata", func() {
+			i := &eureka.Instance{Metadata: eureka.Metadata{"zone": "zone-a"}}
+			Expect(i.Zone()).To(Equal("zone-a"))
+		})
+	})
+
+	Describe("Address", func() {
+		It("uses the IP address and the regular or secure port", func() {
+			i := &eureka.Instance{IPAddr: "10.0.0.1", HostName: "one.example.com", Port: 80, SecurePort: 443}
+
+			Expect(i.Address(false)).To(Equal("10.0.0.1:80"))
+			Expect(i.Address(true)).To(Equal("10.0.0.1:443"))
+		})
+
+		It("falls back to the host name", func() {
+			i := &eureka.Instance{HostName: "one.example.com", Port: 80, SecurePort: 443}
+			Expect(i.Address(true)).To(Equal("one.example.com:443"))
+		})
+	})
+
+	Describe("Lease", func() {
+		var (
+			now   = time.Unix(1468519790, 0)
+			lease *eureka.Instance
+		)
+
+		BeforeEach(func() {
+			lease = &eureka.Instance{
+				LeaseInfo: eureka.Lease{
+					Duration:         eureka.Duration(90 * time.Second),
+					RegistrationTime: eureka.Time(now.Add(-time.Hour)),
+					LastRenewalTime:  eureka.Time(now.Add(-30 * time.Second)),
+				},
+			}
+		})
+
+		It("is valid for the lease duration since the last renewal", func() {
+			Expect(lease.LeaseRemaining(now)).To(Equal(60 * time.Second))
+			Expect(lease.LeaseExpired(now)).To(BeFalse())
+		})
+
+		It("expires once the lease duration has passed", func() {
+			Expect(lease.LeaseRemaining(now.Add(2 * time.Minute))).To(Equal(-60 * time.Second))
+			Expect(lease.LeaseExpired(now.Add(2 * time.Minute))).To(BeTrue())
+		})
+
+		It("falls back to the registration time if it has never been renewed", func() {
+			lease.LeaseInfo.LastRenewalTime = eureka.Time(time.Unix(0, 0))
+			Expect(lease.LeaseRemaining(now)).To(Equal(-time.Hour + 90*time.Second))
+			Expect(lease.LeaseExpired(now)).To(BeTrue())
+		})
+
+		It("never expires without lease information", func() {
+			lease.LeaseInfo = eureka.Lease{}
+			Expect(lease.LeaseRemaining(now)).To(BeZero())
+			Expect(lease.LeaseExpired(now)).To(BeFalse())
+		})
+	})
 })
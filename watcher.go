@@ -1,7 +1,11 @@
 package eureka
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/net/context"
@@ -11,6 +15,11 @@ import (
 // the registry.
 const DefaultPollInterval = 30 * time.Second
 
+// DefaultStalenessFactor defines after how many poll intervals without a
+// successful poll a watcher is considered unhealthy, unless a different
+// threshold has been set using WatchStaleness.
+const DefaultStalenessFactor = 3
+
 // EventType defines the type of an observed event.
 type EventType uint8
 
@@ -26,33 +35,261 @@ const (
 	// EventInstanceUpdated indicates that a previously registered instance has
 	// changed in the registry, e.g. status or metadata changes have been observed.
 	EventInstanceUpdated
+
+	// EventInstanceUp indicates that the status of a previously registered
+	// instance has changed to UP. Only reported if enabled by
+	// WatchStatusEvents, in place of EventInstanceUpdated.
+	EventInstanceUp
+
+	// EventInstanceDown indicates that the status of a previously registered
+	// instance has changed from UP to any other status. Only reported if
+	// enabled by WatchStatusEvents, in place of EventInstanceUpdated.
+	EventInstanceDown
+
+	// EventInstanceStatusChanged indicates any other status change of a
+	// previously registered instance, e.g. from STARTING to OUT_OF_SERVICE.
+	// Only reported if enabled by WatchStatusEvents, in place of
+	// EventInstanceUpdated.
+	EventInstanceStatusChanged
+
+	// EventSelfPreservation is a warning that indicates that the watcher
+	// suppresses deregistrations, because more instances disappeared at once
+	// than allowed by WatchSelfPreservation. It is reported once whenever the
+	// watcher starts suppressing deregistrations. The Instance of the event is
+	// nil.
+	EventSelfPreservation
+
+	// EventInstanceLeaseExpired indicates that the lease of a registered
+	// instance has expired, i.e. it has not renewed its lease in time, but
+	// has not been evicted yet. Only reported if enabled by WatchLeaseExpiry.
+	EventInstanceLeaseExpired
 )
 
 // Event holds information about the type and subject of an observation.
+// Previous holds the instance as it was observed before for all kinds of
+// update events, it is nil for registrations and deregistrations.
 type Event struct {
 	Type     EventType
 	Instance *Instance
+	Previous *Instance
+}
+
+// Changes lists the fields that have changed, see Instance.Diff. It returns
+// nil for registrations and deregistrations.
+func (e Event) Changes() []string {
+	if e.Previous == nil || e.Instance == nil {
+		return nil
+	}
+
+	return e.Previous.Diff(e.Instance)
 }
 
 // Watcher can be used to observe the registry for changes with respect
 // to the instances of particular app.
 type Watcher struct {
-	events    chan Event
-	instances map[string]*Instance
+	filter
+	instances map[string]watched
+	ctx       context.Context
 	cancel    context.CancelFunc
+	synced    chan struct{}
+	buffer    int
+	overflow  OverflowPolicy
+	flapping  time.Duration
+	errors    chan error
+	onError   func(error)
+	staleness time.Duration
+	status    bool
+	deltas    bool
+
+	// batch subscriptions
+	batchMaxDelay time.Duration
+
+	// lease expiry
+	leases       bool
+	excludeStale bool
+	expired      map[string]bool
+
+	// self-preservation
+	preserve    float64
+	preserveFor time.Duration
+	preserving  time.Time
+
+	mtx      sync.RWMutex
+	started  time.Time
+	lastPoll time.Time
+	failures int
+	snapshot map[string][]*Instance
+
+	// subMtx guards subs and is held while the snapshot is being replaced
+	subMtx      sync.Mutex
+	subs        []*Subscription
+	primary     *Subscription
+	primaryOnce sync.Once
+}
+
+// watched is an instance observed by the watcher.
+type watched struct {
+	app      string
+	instance *Instance
+}
+
+// WatchOption can be used to configure a Watcher.
+type WatchOption func(*Watcher)
+
+// WatchBuffer sets the number of events the watcher buffers for its consumer.
+// By default, a single event is being buffered.
+func WatchBuffer(size int) WatchOption {
+	return func(w *Watcher) {
+		w.buffer = size
+	}
+}
+
+// WatchOverflow defines how the watcher handles events that exceed its buffer.
+// By default, the watcher stops polling until the consumer caught up.
+func WatchOverflow(policy OverflowPolicy) WatchOption {
+	return func(w *Watcher) {
+		w.overflow = policy
+	}
 }
 
-// Registry is being used to poll for registered Apps.
+// WatchStatusEvents makes the watcher report status changes using the
+// dedicated EventInstanceUp, EventInstanceDown and EventInstanceStatusChanged
+// event types instead of EventInstanceUpdated.
+func WatchStatusEvents() WatchOption {
+	return func(w *Watcher) {
+		w.status = true
+	}
+}
+
+// WatchSelfPreservation protects consumers from mass deregistrations, e.g. if
+// a registry node restarted with an empty registry. If more than the given
+// percentage of the known instances disappears at once, the watcher
+// suppresses their deregistration and reports EventSelfPreservation instead.
+// Suppressed instances remain part of the snapshot. Once the given expiry has
+// passed, the suppressed deregistrations are being reported after all. An
+// expiry of zero suppresses deregistrations until the instances reappear or
+// fall below the threshold.
+func WatchSelfPreservation(percent float64, expiry time.Duration) WatchOption {
+	return func(w *Watcher) {
+		w.preserve = percent
+		w.preserveFor = expiry
+	}
+}
+
+// WatchLeaseExpiry makes the watcher report EventInstanceLeaseExpired once
+// the lease of an instance has expired, see Instance.LeaseExpired. If exclude
+// is set, such instances are also removed from snapshots until they renew
+// their lease, at which point they are reported as registered again. The
+// expiry event then takes the place of the deregistration.
+func WatchLeaseExpiry(exclude bool) WatchOption {
+	return func(w *Watcher) {
+		w.leases = true
+		w.excludeStale = exclude
+	}
+}
+
+// WatchApps restricts the watcher to instances of the given apps. App names
+// are compared case-insensitively. If a single app is being watched, the
+// watcher only polls that app instead of the entire registry.
+func WatchApps(names ...string) WatchOption {
+	return func(w *Watcher) {
+		w.apps = append(w.apps, names...)
+	}
+}
+
+// WatchVIPs restricts the watcher to instances with one of the given VIP or
+// secure VIP addresses.
+func WatchVIPs(vips ...string) WatchOption {
+	return func(w *Watcher) {
+		w.vips = append(w.vips, vips...)
+	}
+}
+
+// WatchFilter restricts the watcher to instances that satisfy the given
+// predicate. The option can be used multiple times, in which case instances
+// have to satisfy all predicates.
+func WatchFilter(predicate func(*Instance) bool) WatchOption {
+	return func(w *Watcher) {
+		w.filters = append(w.filters, predicate)
+	}
+}
+
+// WatchErrorHandler registers a callback that is invoked with every error
+// that occurs while polling the registry. The callback is invoked from the
+// poll loop and should therefore return quickly.
+func WatchErrorHandler(handler func(error)) WatchOption {
+	return func(w *Watcher) {
+		w.onError = handler
+	}
+}
+
+// WatchStaleness sets the time after which a watcher without a successful
+// poll is being reported as unhealthy. Defaults to DefaultStalenessFactor
+// times the poll interval.
+func WatchStaleness(threshold time.Duration) WatchOption {
+	return func(w *Watcher) {
+		w.staleness = threshold
+	}
+}
+
+// Registry is being used to poll for registered Apps. Registries that also
+// implement VisitInstances, such as Client, are being read in a streaming
+// fashion instead, i.e. instances excluded by the watch options are never
+// held in memory all at once.
 type Registry interface {
 	Apps() ([]*App, error)
 }
 
-func newWatcher(registry Registry, pollInterval time.Duration) *Watcher {
+type instanceVisitorRegistry interface {
+	VisitInstances(visit InstanceVisitor) error
+}
+
+type appRegistry interface {
+	App(appName string) (*App, error)
+}
+
+// visitInstances returns a function that feeds all instances in the registry
+// to a given visitor.
+func visitInstances(registry Registry) func(InstanceVisitor) error {
+	if r, ok := registry.(instanceVisitorRegistry); ok {
+		return r.VisitInstances
+	}
+
+	return func(visit InstanceVisitor) error {
+		apps, err := registry.Apps()
+		if err != nil {
+			return err
+		}
+
+		for _, a := range apps {
+			for _, i := range a.Instances {
+				if err := visit(a.Name, i); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+}
+
+// NewWatcher returns a new watcher that polls the given registry right away
+// and keeps polling it at the defined interval. Observed changes are reported
+// on its Events() channel.
+func NewWatcher(registry Registry, pollInterval time.Duration, options ...WatchOption) *Watcher {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	watcher := &Watcher{
-		events: make(chan Event),
-		cancel: cancel,
+		ctx:       ctx,
+		cancel:    cancel,
+		errors:    make(chan error, 1),
+		synced:    make(chan struct{}),
+		staleness: DefaultStalenessFactor * pollInterval,
+		started:   time.Now(),
+	}
+
+	for _, opt := range options {
+		opt(watcher)
 	}
 
 	go watcher.poll(ctx, registry, pollInterval)
@@ -60,71 +297,444 @@ func newWatcher(registry Registry, pollInterval time.Duration) *Watcher {
 	return watcher
 }
 
-// Stop the watcher, i.e. the registry is no longer being polled.
+// Stop the watcher, i.e. the registry is no longer being polled. Buffered
+// events are discarded and the Events() channels of the watcher and all of
+// its subscriptions are closed once Stop returns.
 func (w *Watcher) Stop() {
 	w.cancel()
+
+	w.subMtx.Lock()
+	subs := w.subs
+	w.subMtx.Unlock()
+
+	for _, s := range subs {
+		<-s.done
+	}
 }
 
 // Events returns a channel that can be used to listen for changes to the app
-// observed by this watcher.
+// observed by this watcher. The channel is closed when the watcher stops. Use
+// Subscribe to have multiple consumers listen for changes.
+//
+// The channel is created by the first call to Events, it starts out with the
+// instances known to the watcher at that point, see Subscribe.
 func (w *Watcher) Events() <-chan Event {
-	return w.events
+	w.primaryOnce.Do(func() {
+		w.primary = w.newSubscription(&Watcher{
+			buffer:   w.buffer,
+			overflow: w.overflow,
+			flapping: w.flapping,
+		})
+		w.primary.events = make(chan Event)
+		w.subscribe(w.primary)
+	})
+
+	return w.primary.Events()
+}
+
+// Errors returns a channel that reports errors that occur while polling the
+// registry. Errors are dropped if the channel is not being drained. The
+// channel is closed when the watcher stops polling.
+func (w *Watcher) Errors() <-chan error {
+	return w.errors
+}
+
+// ConsecutiveFailures returns the number of polls that have failed since the
+// last successful one.
+func (w *Watcher) ConsecutiveFailures() int {
+	w.mtx.RLock()
+	defer w.mtx.RUnlock()
+	return w.failures
+}
+
+// LastSuccessfulPoll returns the time of the last successful poll. The zero
+// time is returned if the registry has not been polled successfully yet.
+func (w *Watcher) LastSuccessfulPoll() time.Time {
+	w.mtx.RLock()
+	defer w.mtx.RUnlock()
+	return w.lastPoll
+}
+
+// Healthy reports whether the watcher has successfully polled the registry
+// within its staleness threshold, see WatchStaleness. A newly started
+// watcher is healthy until the threshold has passed.
+func (w *Watcher) Healthy() bool {
+	w.mtx.RLock()
+	defer w.mtx.RUnlock()
+
+	since := w.started
+	if w.lastPoll.After(since) {
+		since = w.lastPoll
+	}
+
+	return time.Since(since) <= w.staleness
+}
+
+// WaitForSync blocks until the watcher has polled the registry successfully
+// for the first time, i.e. until Snapshot() reflects the registry. It returns
+// an error if ctx is done or the watcher has been stopped before that.
+func (w *Watcher) WaitForSync(ctx context.Context) error {
+	select {
+	case <-w.synced:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-w.ctx.Done():
+		return w.ctx.Err()
+	}
+}
+
+// Snapshot returns the instances observed by the latest successful poll,
+// indexed by app name. The returned instances must not be modified.
+func (w *Watcher) Snapshot() map[string][]*Instance {
+	w.mtx.RLock()
+	defer w.mtx.RUnlock()
+
+	snapshot := make(map[string][]*Instance, len(w.snapshot))
+	for app, instances := range w.snapshot {
+		snapshot[app] = append([]*Instance(nil), instances...)
+	}
+
+	return snapshot
 }
 
 func (w *Watcher) poll(ctx context.Context, registry Registry, interval time.Duration) {
 	tick := time.NewTicker(interval)
 	defer tick.Stop()
+	defer close(w.errors)
+
+	update := w.poller(registry)
+
+	w.report(update())
+	w.endPoll()
 
 	for {
 		select {
 		case <-tick.C:
-			if apps, err := registry.Apps(); err == nil {
-				w.update(apps)
-			}
+			w.report(update())
+			w.endPoll()
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-func (w *Watcher) update(apps []*App) {
-	current := map[string]*Instance{}
+// report records the outcome of a poll.
+func (w *Watcher) report(err error) {
+	w.mtx.Lock()
+	if err != nil {
+		w.failures++
+	} else {
+		w.failures = 0
+		w.lastPoll = time.Now()
+	}
+	w.mtx.Unlock()
+
+	if err == nil {
+		return
+	}
+
+	if w.onError != nil {
+		w.onError(err)
+	}
+
+	// non-blocking
+	select {
+	case w.errors <- err:
+	default:
+	}
+}
+
+func (w *Watcher) update(visit func(InstanceVisitor) error) error {
+	return w.updateAt(visit, time.Now())
+}
+
+// updateAt is like update but checks leases as of the given time.
+func (w *Watcher) updateAt(visit func(InstanceVisitor) error, now time.Time) error {
+	var (
+		current = make(map[string]watched, len(w.instances))
+		keys    = make([]string, 0, len(w.instances))
+	)
+
+	// collect the current instances, a retried request might visit instances
+	// more than once
+	err := visit(func(appName string, i *Instance) error {
+		if !w.matches(appName, i) {
+			return nil
+		}
+
+		k := key(appName, i)
+		if _, found := current[k]; !found {
+			keys = append(keys, k)
+		}
+		current[k] = watched{appName, i}
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	warn := w.selfPreserve(current, &keys)
+	expired := w.checkLeases(current, &keys, now)
+
+	apps := make(map[string][]*Instance)
+	for _, k := range keys {
+		c := current[k]
+		apps[c.app] = append(apps[c.app], c.instance)
+	}
+
+	// new subscribers either see the previous snapshot and the events below,
+	// or the current snapshot only
+	w.subMtx.Lock()
+
+	// update the snapshot before notifying, a slow consumer must not delay it
+	w.mtx.Lock()
+	if w.snapshot == nil {
+		close(w.synced)
+	}
+	w.snapshot = apps
+	w.mtx.Unlock()
+
+	// a blocking subscription must not keep others from subscribing or
+	// cancelling while the events are being published
+	subs := w.subs
+	w.subMtx.Unlock()
+
+	if warn {
+		notify(subs, "", "", Event{EventSelfPreservation, nil, nil})
+	}
 
 	// check if instances are new or have changed
-	for _, a := range apps {
-		for _, i := range a.Instances {
-			key := key(a, i)
-			current[key] = i
-
-			prev, found := w.instances[key]
-			if !found {
-				w.notify(EventInstanceRegistered, i)
-				continue
-			}
+	for _, key := range keys {
+		c := current[key]
+
+		prev, found := w.instances[key]
+		if !found {
+			notify(subs, c.app, key, Event{EventInstanceRegistered, c.instance, nil})
+			continue
+		}
 
-			delete(w.instances, key)
+		delete(w.instances, key)
 
-			if !i.Equals(prev) {
-				w.notify(EventInstanceUpdated, i)
-			}
+		if !c.instance.Equals(prev.instance) {
+			notify(subs, c.app, key, Event{w.updateType(prev.instance, c.instance), c.instance, prev.instance})
 		}
 	}
 
 	// instances we haven't deleted above are not registered anymore
-	for _, i := range w.instances {
-		w.notify(EventInstanceDeregistered, i)
+	for key, prev := range w.instances {
+		if _, found := expired[key]; !found {
+			notify(subs, prev.app, key, Event{EventInstanceDeregistered, prev.instance, nil})
+		}
+	}
+
+	for _, key := range sortedKeys(expired) {
+		e := expired[key]
+		notify(subs, e.app, key, Event{EventInstanceLeaseExpired, e.instance, nil})
 	}
 
 	// reset instances
 	w.instances = current
+
+	return nil
+}
+
+// selfPreserve adds known instances that have disappeared to the current
+// instances if too many have disappeared at once, see WatchSelfPreservation.
+// It returns true if the watcher has just started to do so.
+func (w *Watcher) selfPreserve(current map[string]watched, keys *[]string) bool {
+	if w.preserve <= 0 || len(w.instances) == 0 {
+		return false
+	}
+
+	var missing []string
+	for k := range w.instances {
+		if _, found := current[k]; !found {
+			missing = append(missing, k)
+		}
+	}
+
+	if float64(len(missing))*100 <= w.preserve*float64(len(w.instances)) {
+		w.preserving = time.Time{}
+		return false
+	}
+
+	now := time.Now()
+	started := w.preserving.IsZero()
+	if started {
+		w.preserving = now
+	}
+
+	if w.preserveFor > 0 && now.Sub(w.preserving) >= w.preserveFor {
+		// give up and report the deregistrations after all
+		w.preserving = time.Time{}
+		return false
+	}
+
+	sort.Strings(missing)
+	for _, k := range missing {
+		current[k] = w.instances[k]
+		*keys = append(*keys, k)
+	}
+
+	return started
+}
+
+// checkLeases checks the leases of the current instances, see
+// WatchLeaseExpiry. It returns the instances whose lease has expired since the
+// previous poll.
+func (w *Watcher) checkLeases(current map[string]watched, keys *[]string, now time.Time) map[string]watched {
+	if !w.leases {
+		return nil
+	}
+
+	var (
+		expired = make(map[string]bool)
+		fresh   = make(map[string]watched)
+		kept    = (*keys)[:0]
+	)
+
+	for _, k := range *keys {
+		c := current[k]
+		if !c.instance.LeaseExpired(now) {
+			kept = append(kept, k)
+			continue
+		}
+
+		expired[k] = true
+
+		_, known := w.instances[k]
+		if !w.expired[k] && (known || !w.excludeStale) {
+			fresh[k] = c
+		}
+
+		if w.excludeStale {
+			delete(current, k)
+			continue
+		}
+
+		kept = append(kept, k)
+	}
+
+	*keys = kept
+	w.expired = expired
+
+	return fresh
+}
+
+func sortedKeys(instances map[string]watched) []string {
+	keys := make([]string, 0, len(instances))
+	for k := range instances {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// source returns a function that feeds the instances to be watched to a
+// given visitor. If a single app is being watched and the registry supports
+// it, only that app is retrieved.
+func (w *Watcher) source(registry Registry) func(InstanceVisitor) error {
+	r, ok := registry.(appRegistry)
+	if !ok || len(w.apps) != 1 {
+		return visitInstances(registry)
+	}
+
+	return func(visit InstanceVisitor) error {
+		app, err := r.App(w.apps[0])
+		if errors.Is(err, ErrNotFound) {
+			// the app has no registered instances
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		for _, i := range app.Instances {
+			if err := visit(app.Name, i); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
 }
 
-func (w *Watcher) notify(t EventType, i *Instance) {
-	// blocking
-	w.events <- Event{t, i}
+// filter restricts the instances observed by a watcher or subscription.
+type filter struct {
+	apps    []string
+	vips    []string
+	filters []func(*Instance) bool
+}
+
+// matches checks if an instance satisfies the filters.
+func (f *filter) matches(appName string, i *Instance) bool {
+	if len(f.apps) > 0 && !containsFold(f.apps, appName) {
+		return false
+	}
+
+	if len(f.vips) > 0 && !hasVIP(f.vips, i) {
+		return false
+	}
+
+	for _, f := range f.filters {
+		if !f(i) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasVIP checks if the instance has one of the given VIP addresses. An
+// instance can have multiple comma-separated VIP addresses.
+func hasVIP(vips []string, i *Instance) bool {
+	for _, addrs := range []string{i.VIPAddr, i.SecureVIPAddr} {
+		for _, addr := range strings.Split(addrs, ",") {
+			for _, vip := range vips {
+				if strings.TrimSpace(addr) == vip {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// notify publishes an event to the given subscriptions.
+func notify(subs []*Subscription, appName, key string, e Event) {
+	for _, s := range subs {
+		s.publish(appName, key, e)
+	}
+}
+
+// updateType returns the type of the event that reports a change from prev
+// to next.
+func (w *Watcher) updateType(prev, next *Instance) EventType {
+	switch {
+	case !w.status || prev.Status == next.Status:
+		return EventInstanceUpdated
+	case next.Status == StatusUp:
+		return EventInstanceUp
+	case prev.Status == StatusUp:
+		return EventInstanceDown
+	default:
+		return EventInstanceStatusChanged
+	}
 }
 
-func key(a *App, i *Instance) string {
+func key(appName string, i *Instance) string {
 	// instance ids might not be unique across apps
-	return fmt.Sprintf("%s-%s", a.Name, i.ID)
+	return fmt.Sprintf("%s-%s", appName, i.ID)
 }
@@ -1,9 +1,13 @@
 package eureka
 
 import (
+	"errors"
+	"net/http"
 	"sync"
 	"time"
 
+	"golang.org/x/net/context"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -35,7 +39,7 @@ var _ = Describe("Watcher", func() {
 		registry = newMockRegistry()
 		registry.Register(existingApp)
 
-		watcher = newWatcher(registry, interval)
+		watcher = NewWatcher(registry, interval)
 
 		// should receive event for the above register
 		Eventually(watcher.Events()).Should(Receive())
@@ -59,6 +63,7 @@ var _ = Describe("Watcher", func() {
 		expectedEvent := Event{
 			EventInstanceRegistered,
 			instance,
+			nil,
 		}
 
 		registry.Register(app)
@@ -76,6 +81,7 @@ var _ = Describe("Watcher", func() {
 		expectedEvent := Event{
 			EventInstanceRegistered,
 			instance,
+			nil,
 		}
 
 		registry.Register(existingApp)
@@ -84,6 +90,7 @@ var _ = Describe("Watcher", func() {
 	})
 
 	It("reports instances that have been changed", func() {
+		previous := existingApp.Instances[0]
 		existingApp.Instances[0] = &Instance{
 			ID:       "one",
 			HostName: "updated.example.com",
@@ -92,6 +99,7 @@ var _ = Describe("Watcher", func() {
 		expectedEvent := Event{
 			EventInstanceUpdated,
 			existingApp.Instances[0],
+			previous,
 		}
 
 		registry.Register(existingApp)
@@ -103,6 +111,7 @@ var _ = Describe("Watcher", func() {
 		expectedEvent := Event{
 			EventInstanceDeregistered,
 			existingApp.Instances[0],
+			nil,
 		}
 
 		existingApp.Instances = existingApp.Instances[1:]
@@ -116,6 +125,7 @@ var _ = Describe("Watcher", func() {
 		expectedEvent := Event{
 			EventInstanceDeregistered,
 			existingApp.Instances[0],
+			nil,
 		}
 
 		registry.Deregister(existingApp.Name)
@@ -124,9 +134,734 @@ var _ = Describe("Watcher", func() {
 	})
 })
 
+var _ = Describe("Watcher event delivery", func() {
+	var (
+		interval = 10 * time.Millisecond
+		registry *mockRegistry
+	)
+
+	BeforeEach(func() {
+		registry = newMockRegistry()
+		registry.Register(&App{
+			Name: "app",
+			Instances: []*Instance{
+				&Instance{ID: "one"},
+				&Instance{ID: "two"},
+				&Instance{ID: "three"},
+			},
+		})
+	})
+
+	It("closes the events channel when stopped", func() {
+		watcher := NewWatcher(registry, interval)
+		Eventually(watcher.Events()).Should(Receive())
+
+		watcher.Stop()
+
+		Eventually(watcher.Events()).Should(BeClosed())
+	})
+
+	// scaleUp registers more instances once the watcher has polled, which
+	// makes it observe events after its consumer subscribed.
+	scaleUp := func() int {
+		Eventually(registry.AppsCalls).Should(BeNumerically(">", 0))
+
+		registry.Register(&App{
+			Name: "app",
+			Instances: []*Instance{
+				&Instance{ID: "one"},
+				&Instance{ID: "two"},
+				&Instance{ID: "three"},
+				&Instance{ID: "four"},
+				&Instance{ID: "five"},
+				&Instance{ID: "six"},
+			},
+		})
+
+		return registry.AppsCalls()
+	}
+
+	It("blocks polling until events are consumed", func() {
+		watcher := NewWatcher(registry, interval)
+		defer watcher.Stop()
+
+		events := watcher.Events()
+		calls := scaleUp()
+
+		// at most the poll in progress observes the new instances
+		Consistently(registry.AppsCalls, 10*interval).Should(BeNumerically("<=", calls+1))
+
+		for n := 0; n < 6; n++ {
+			Eventually(events).Should(Receive())
+		}
+		Eventually(registry.AppsCalls).Should(BeNumerically(">", calls+3))
+	})
+
+	It("stops even if nobody consumes its events", func() {
+		watcher := NewWatcher(registry, interval)
+
+		events := watcher.Events()
+		calls := scaleUp()
+		Consistently(registry.AppsCalls, 5*interval).Should(BeNumerically("<=", calls+1))
+
+		stopped := make(chan struct{})
+		go func() {
+			watcher.Stop()
+			close(stopped)
+		}()
+
+		Eventually(stopped).Should(BeClosed())
+		Eventually(events).Should(BeClosed())
+	})
+
+	It("keeps polling while events are buffered", func() {
+		watcher := NewWatcher(registry, interval, WatchBuffer(10))
+		defer watcher.Stop()
+
+		events := watcher.Events()
+		calls := scaleUp()
+
+		Eventually(registry.AppsCalls).Should(BeNumerically(">", calls+3))
+		for n := 0; n < 6; n++ {
+			Eventually(events).Should(Receive())
+		}
+		Consistently(events).ShouldNot(Receive())
+	})
+
+	It("drops the oldest events when the buffer overflows", func() {
+		watcher := NewWatcher(registry, interval, WatchBuffer(1), WatchOverflow(OverflowDropOldest))
+		defer watcher.Stop()
+
+		events := watcher.Events()
+		calls := scaleUp()
+
+		// polling continues although nobody consumes events
+		Eventually(registry.AppsCalls).Should(BeNumerically(">", calls+3))
+
+		// the latest event is retained, at most one older one is in flight
+		var ids []string
+		Eventually(func() []string {
+			select {
+			case e := <-events:
+				ids = append(ids, e.Instance.ID)
+			default:
+			}
+			return ids
+		}).Should(ContainElement("six"))
+
+		Consistently(events).ShouldNot(Receive())
+		Expect(len(ids)).To(BeNumerically("<=", 2))
+		Expect(ids[len(ids)-1]).To(Equal("six"))
+	})
+})
+
+var _ = Describe("Watcher sync", func() {
+	var (
+		registry *mockRegistry
+		watcher  *Watcher
+	)
+
+	BeforeEach(func() {
+		registry = newMockRegistry()
+		registry.Register(&App{
+			Name: "one",
+			Instances: []*Instance{
+				&Instance{ID: "a"},
+				&Instance{ID: "b"},
+			},
+		})
+		registry.Register(&App{
+			Name:      "two",
+			Instances: []*Instance{&Instance{ID: "c"}},
+		})
+	})
+
+	AfterEach(func() {
+		watcher.Stop()
+	})
+
+	It("polls right away", func() {
+		watcher = NewWatcher(registry, time.Hour, WatchBuffer(10))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		Expect(watcher.WaitForSync(ctx)).To(Succeed())
+		Expect(registry.AppsCalls()).To(Equal(1))
+		Eventually(watcher.Events()).Should(Receive())
+	})
+
+	It("returns a snapshot indexed by app", func() {
+		watcher = NewWatcher(registry, time.Hour)
+		Expect(watcher.WaitForSync(context.Background())).To(Succeed())
+
+		snapshot := watcher.Snapshot()
+		Expect(snapshot).To(HaveLen(2))
+		Expect(snapshot["one"]).To(ConsistOf(
+			&Instance{ID: "a"},
+			&Instance{ID: "b"},
+		))
+		Expect(snapshot["two"]).To(ConsistOf(&Instance{ID: "c"}))
+	})
+
+	It("keeps the snapshot up to date", func() {
+		watcher = NewWatcher(registry, 10*time.Millisecond)
+
+		registry.Deregister("one")
+
+		Eventually(watcher.Snapshot).Should(Equal(map[string][]*Instance{
+			"two": []*Instance{&Instance{ID: "c"}},
+		}))
+	})
+
+	It("does not wait for consumers to sync", func() {
+		// nobody is consuming events
+		watcher = NewWatcher(registry, time.Hour, WatchBuffer(1))
+		Expect(watcher.WaitForSync(context.Background())).To(Succeed())
+	})
+
+	It("gives up waiting when the context is done", func() {
+		registry.Fail(errors.New("failure"))
+		watcher = NewWatcher(registry, time.Hour)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		Expect(watcher.WaitForSync(ctx)).To(Equal(context.DeadlineExceeded))
+		Expect(watcher.Snapshot()).To(BeEmpty())
+	})
+
+	It("gives up waiting when the watcher has been stopped", func() {
+		registry.Fail(errors.New("failure"))
+		watcher = NewWatcher(registry, time.Hour)
+		watcher.Stop()
+
+		Expect(watcher.WaitForSync(context.Background())).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Watcher error reporting", func() {
+	var (
+		interval = 10 * time.Millisecond
+		failure  = errors.New("failure")
+		registry *mockRegistry
+	)
+
+	BeforeEach(func() {
+		registry = newMockRegistry()
+	})
+
+	It("reports errors on its errors channel", func() {
+		registry.Fail(failure)
+
+		watcher := NewWatcher(registry, interval)
+		defer watcher.Stop()
+
+		Eventually(watcher.Errors()).Should(Receive(Equal(failure)))
+	})
+
+	It("reports errors to its error handler", func() {
+		registry.Fail(failure)
+
+		errs := make(chan error, 10)
+		watcher := NewWatcher(registry, interval, WatchErrorHandler(func(err error) {
+			errs <- err
+		}))
+		defer watcher.Stop()
+
+		Eventually(errs).Should(Receive(Equal(failure)))
+	})
+
+	It("closes the errors channel when stopped", func() {
+		watcher := NewWatcher(registry, interval)
+		watcher.Stop()
+
+		Eventually(watcher.Errors()).Should(BeClosed())
+	})
+
+	It("counts consecutive failures", func() {
+		registry.Fail(failure)
+
+		watcher := NewWatcher(registry, interval)
+		defer watcher.Stop()
+
+		Eventually(watcher.ConsecutiveFailures).Should(BeNumerically(">=", 3))
+		Expect(watcher.LastSuccessfulPoll().IsZero()).To(BeTrue())
+
+		registry.Fail(nil)
+
+		Eventually(watcher.ConsecutiveFailures).Should(BeZero())
+		Expect(watcher.LastSuccessfulPoll()).To(BeTemporally("~", time.Now(), time.Second))
+	})
+
+	It("becomes unhealthy once polls have been failing for too long", func() {
+		registry.Fail(failure)
+
+		watcher := NewWatcher(registry, interval, WatchStaleness(50*time.Millisecond))
+		defer watcher.Stop()
+
+		Expect(watcher.Healthy()).To(BeTrue())
+		Eventually(watcher.Healthy).Should(BeFalse())
+
+		registry.Fail(nil)
+
+		Eventually(watcher.Healthy).Should(BeTrue())
+	})
+
+	It("stays healthy while polls succeed", func() {
+		watcher := NewWatcher(registry, interval, WatchStaleness(50*time.Millisecond))
+		defer watcher.Stop()
+
+		Consistently(watcher.Healthy, 200*time.Millisecond).Should(BeTrue())
+	})
+})
+
+var _ = Describe("Watcher with status events", func() {
+	var (
+		registry *mockRegistry
+		watcher  *Watcher
+		instance *Instance
+	)
+
+	setStatus := func(status Status) *Instance {
+		i := *instance
+		i.Status = status
+		instance = &i
+		registry.Register(&App{Name: "app", Instances: []*Instance{instance}})
+		return instance
+	}
+
+	BeforeEach(func() {
+		registry = newMockRegistry()
+		instance = &Instance{ID: "one", Status: StatusStarting}
+		setStatus(StatusStarting)
+
+		watcher = NewWatcher(registry, 10*time.Millisecond, WatchStatusEvents())
+		Eventually(watcher.Events()).Should(Receive())
+	})
+
+	AfterEach(func() {
+		watcher.Stop()
+	})
+
+	It("reports status transitions", func() {
+		prev := instance
+
+		next := setStatus(StatusUp)
+		Eventually(watcher.Events()).Should(Receive(Equal(Event{EventInstanceUp, next, prev})))
+
+		prev, next = next, setStatus(StatusOutOfService)
+		Eventually(watcher.Events()).Should(Receive(Equal(Event{EventInstanceDown, next, prev})))
+
+		prev, next = next, setStatus(StatusDown)
+		Eventually(watcher.Events()).Should(Receive(Equal(Event{EventInstanceStatusChanged, next, prev})))
+	})
+
+	It("reports other changes as updates", func() {
+		i := *instance
+		i.HostName = "changed"
+		registry.Register(&App{Name: "app", Instances: []*Instance{&i}})
+
+		var e Event
+		Eventually(watcher.Events()).Should(Receive(&e))
+		Expect(e.Type).To(Equal(EventInstanceUpdated))
+		Expect(e.Changes()).To(Equal([]string{"HostName"}))
+	})
+})
+
+var _ = Describe("Watcher with self-preservation", func() {
+	var (
+		interval  = 10 * time.Millisecond
+		registry  *mockRegistry
+		instances []*Instance
+	)
+
+	BeforeEach(func() {
+		instances = []*Instance{
+			&Instance{ID: "one"},
+			&Instance{ID: "two"},
+			&Instance{ID: "three"},
+			&Instance{ID: "four"},
+		}
+
+		registry = newMockRegistry()
+		registry.Register(&App{Name: "app", Instances: instances})
+	})
+
+	drain := func(watcher *Watcher) {
+		for range instances {
+			Eventually(watcher.Events()).Should(Receive())
+		}
+	}
+
+	It("suppresses mass deregistrations", func() {
+		watcher := NewWatcher(registry, interval, WatchSelfPreservation(50, 0))
+		defer watcher.Stop()
+		drain(watcher)
+
+		registry.Deregister("app")
+
+		Eventually(watcher.Events()).Should(Receive(Equal(Event{EventSelfPreservation, nil, nil})))
+		Consistently(watcher.Events()).ShouldNot(Receive())
+		Expect(watcher.Snapshot()["app"]).To(HaveLen(4))
+	})
+
+	It("reports deregistrations below the threshold", func() {
+		watcher := NewWatcher(registry, interval, WatchSelfPreservation(50, 0))
+		defer watcher.Stop()
+		drain(watcher)
+
+		registry.Register(&App{Name: "app", Instances: instances[:2]})
+
+		var events []Event
+		for range instances[2:] {
+			var e Event
+			Eventually(watcher.Events()).Should(Receive(&e))
+			events = append(events, e)
+		}
+
+		Expect(events).To(ConsistOf(
+			Event{EventInstanceDeregistered, instances[2], nil},
+			Event{EventInstanceDeregistered, instances[3], nil},
+		))
+	})
+
+	It("stops suppressing once the instances reappear", func() {
+		watcher := NewWatcher(registry, interval, WatchSelfPreservation(50, 0))
+		defer watcher.Stop()
+		drain(watcher)
+
+		registry.Deregister("app")
+		Eventually(watcher.Events()).Should(Receive(Equal(Event{EventSelfPreservation, nil, nil})))
+
+		registry.Register(&App{Name: "app", Instances: instances})
+		Consistently(watcher.Events()).ShouldNot(Receive())
+
+		registry.Deregister("app")
+		Eventually(watcher.Events()).Should(Receive(Equal(Event{EventSelfPreservation, nil, nil})))
+	})
+
+	It("reports suppressed deregistrations once expired", func() {
+		watcher := NewWatcher(registry, interval, WatchSelfPreservation(50, 50*time.Millisecond))
+		defer watcher.Stop()
+		drain(watcher)
+
+		registry.Deregister("app")
+
+		Eventually(watcher.Events()).Should(Receive(Equal(Event{EventSelfPreservation, nil, nil})))
+		for range instances {
+			Eventually(watcher.Events()).Should(Receive(HaveField("Type", EventInstanceDeregistered)))
+		}
+		Expect(watcher.Snapshot()).To(BeEmpty())
+	})
+})
+
+var _ = Describe("Watcher with deltas", func() {
+	var (
+		interval = 10 * time.Millisecond
+		registry *mockDeltaRegistry
+		watcher  *Watcher
+		one, two *Instance
+	)
+
+	BeforeEach(func() {
+		one = &Instance{ID: "one", Status: StatusUp}
+		two = &Instance{ID: "two", Status: StatusUp}
+
+		registry = &mockDeltaRegistry{mockRegistry: newMockRegistry()}
+		registry.Register(&App{Name: "app", Instances: []*Instance{one}})
+
+		watcher = NewWatcher(registry, interval, WatchDeltas())
+		Eventually(watcher.Events()).Should(Receive(Equal(Event{EventInstanceRegistered, one, nil})))
+	})
+
+	AfterEach(func() {
+		watcher.Stop()
+	})
+
+	It("reports changes from the delta", func() {
+		calls := registry.AppsCalls()
+
+		added := *two
+		added.ActionType = ActionAdded
+		registry.Register(&App{Name: "app", Instances: []*Instance{one, two}})
+		registry.SetDelta(&AppsResponse{
+			Hashcode: "UP_2_",
+			Apps:     []*App{&App{Name: "app", Instances: []*Instance{&added}}},
+		})
+
+		Eventually(watcher.Events()).Should(Receive(Equal(Event{EventInstanceRegistered, &added, nil})))
+		Expect(watcher.Snapshot()["app"]).To(Equal([]*Instance{one, &added}))
+
+		modified := *one
+		modified.Status = StatusDown
+		modified.ActionType = ActionModified
+		deleted := added
+		deleted.ActionType = ActionDeleted
+		registry.SetDelta(&AppsResponse{
+			Hashcode: "DOWN_1_",
+			Apps:     []*App{&App{Name: "app", Instances: []*Instance{&modified, &deleted}}},
+		})
+
+		Eventually(watcher.Events()).Should(Receive(Equal(Event{EventInstanceUpdated, &modified, one})))
+		Eventually(watcher.Events()).Should(Receive(Equal(Event{EventInstanceDeregistered, &added, nil})))
+		Expect(watcher.Snapshot()["app"]).To(Equal([]*Instance{&modified}))
+
+		Expect(registry.AppsCalls()).To(Equal(calls))
+	})
+
+	It("ignores repeated deltas", func() {
+		registry.SetDelta(&AppsResponse{
+			Hashcode: "UP_1_",
+			Apps:     []*App{&App{Name: "app", Instances: []*Instance{one}}},
+		})
+
+		Eventually(registry.DeltaCalls).Should(BeNumerically(">", 2))
+		Consistently(watcher.Events()).ShouldNot(Receive())
+	})
+
+	It("falls back to the entire registry when the hashcode does not match", func() {
+		calls := registry.AppsCalls()
+
+		// the delta misses the new instance
+		registry.Register(&App{Name: "app", Instances: []*Instance{one, two}})
+		registry.SetDelta(&AppsResponse{Hashcode: "UP_2_"})
+
+		Eventually(watcher.Events()).Should(Receive(Equal(Event{EventInstanceRegistered, two, nil})))
+		Expect(registry.AppsCalls()).To(BeNumerically(">", calls))
+	})
+
+	It("falls back to the entire registry when the delta fails", func() {
+		registry.FailDelta(errors.New("delta failed"))
+		registry.Register(&App{Name: "app", Instances: []*Instance{one, two}})
+
+		Eventually(watcher.Events()).Should(Receive(Equal(Event{EventInstanceRegistered, two, nil})))
+		Expect(watcher.Healthy()).To(BeTrue())
+
+		// deltas are used again once they recover
+		registry.FailDelta(nil)
+		calls := registry.AppsCalls()
+		Eventually(registry.DeltaCalls).Should(BeNumerically(">", 2))
+		Consistently(registry.AppsCalls, 5*interval).Should(BeNumerically("<=", calls+1))
+	})
+
+	It("polls the entire registry if the registry does not report deltas", func() {
+		registry.FailDelta(&ResponseError{StatusCode: http.StatusForbidden})
+		Eventually(registry.DeltaCalls).Should(BeNumerically(">", 0))
+
+		registry.Register(&App{Name: "app", Instances: []*Instance{one, two}})
+		Eventually(watcher.Events()).Should(Receive(Equal(Event{EventInstanceRegistered, two, nil})))
+
+		calls := registry.DeltaCalls()
+		Consistently(registry.DeltaCalls, 5*interval).Should(Equal(calls))
+	})
+})
+
+var _ = Describe("Watcher with lease expiry", func() {
+	var (
+		interval = 10 * time.Millisecond
+		registry *mockRegistry
+		watcher  *Watcher
+		one      *Instance
+	)
+
+	leased := func(id string, renewed time.Time) *Instance {
+		return &Instance{
+			ID: id,
+			LeaseInfo: Lease{
+				Duration:        Duration(time.Minute),
+				LastRenewalTime: Time(renewed),
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		one = leased("one", time.Now())
+		registry = newMockRegistry()
+		registry.Register(&App{Name: "app", Instances: []*Instance{one}})
+	})
+
+	AfterEach(func() {
+		watcher.Stop()
+	})
+
+	Context("when expired instances are kept", func() {
+		BeforeEach(func() {
+			watcher = NewWatcher(registry, interval, WatchLeaseExpiry(false))
+			Eventually(watcher.Events()).Should(Receive(Equal(Event{EventInstanceRegistered, one, nil})))
+		})
+
+		It("reports expired leases once", func() {
+			stale := leased("one", time.Now().Add(-time.Hour))
+			registry.Register(&App{Name: "app", Instances: []*Instance{stale}})
+
+			Eventually(watcher.Events()).Should(Receive(Equal(Event{EventInstanceLeaseExpired, stale, nil})))
+			Consistently(watcher.Events()).ShouldNot(Receive())
+			Expect(watcher.Snapshot()["app"]).To(Equal([]*Instance{stale}))
+		})
+	})
+
+	Context("when expired instances are excluded", func() {
+		BeforeEach(func() {
+			watcher = NewWatcher(registry, interval, WatchLeaseExpiry(true))
+			Eventually(watcher.Events()).Should(Receive(Equal(Event{EventInstanceRegistered, one, nil})))
+		})
+
+		It("reports expired leases instead of deregistrations", func() {
+			stale := leased("one", time.Now().Add(-time.Hour))
+			registry.Register(&App{Name: "app", Instances: []*Instance{stale}})
+
+			Eventually(watcher.Events()).Should(Receive(Equal(Event{EventInstanceLeaseExpired, stale, nil})))
+			Consistently(watcher.Events()).ShouldNot(Receive())
+			Expect(watcher.Snapshot()).To(BeEmpty())
+
+			// renewed
+			registry.Register(&App{Name: "app", Instances: []*Instance{one}})
+			Eventually(watcher.Events()).Should(Receive(Equal(Event{EventInstanceRegistered, one, nil})))
+		})
+
+		It("does not report instances that are expired from the start", func() {
+			stale := leased("two", time.Now().Add(-time.Hour))
+			registry.Register(&App{Name: "app", Instances: []*Instance{one, stale}})
+
+			Consistently(watcher.Events()).ShouldNot(Receive())
+			Expect(watcher.Snapshot()["app"]).To(Equal([]*Instance{one}))
+		})
+	})
+
+	Context("when polling deltas", func() {
+		var (
+			deltas *mockDeltaRegistry
+			short  = func(renewed time.Time) *Instance {
+				i := leased("one", renewed)
+				i.LeaseInfo.Duration = Duration(50 * time.Millisecond)
+				return i
+			}
+		)
+
+		BeforeEach(func() {
+			one = short(time.Now())
+			deltas = &mockDeltaRegistry{mockRegistry: newMockRegistry()}
+			deltas.Register(&App{Name: "app", Instances: []*Instance{one}})
+
+			watcher = NewWatcher(deltas, interval, WatchDeltas(), WatchLeaseExpiry(true))
+			Eventually(watcher.Events()).Should(Receive(Equal(Event{EventInstanceRegistered, one, nil})))
+		})
+
+		It("verifies expired leases against the entire registry", func() {
+			// renewals are not part of the delta
+			renewed := time.Now()
+			for time.Since(renewed) < 200*time.Millisecond {
+				deltas.Register(&App{Name: "app", Instances: []*Instance{short(time.Now())}})
+				Expect(watcher.Events()).ToNot(Receive())
+				Expect(watcher.Snapshot()["app"]).To(HaveLen(1))
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			Expect(deltas.DeltaCalls()).To(BeNumerically(">", 0))
+
+			// stops renewing
+			Eventually(watcher.Events()).Should(Receive(WithTransform(func(e Event) EventType {
+				return e.Type
+			}, Equal(EventInstanceLeaseExpired))))
+			Expect(watcher.Snapshot()).To(BeEmpty())
+		})
+	})
+})
+
+var _ = Describe("Watcher with filters", func() {
+	var (
+		interval = 10 * time.Millisecond
+
+		registry *mockRegistry
+		watcher  *Watcher
+
+		matching = &Instance{ID: "one", HostName: "one.example.com", VIPAddr: "orders,orders-v2"}
+		other    = &Instance{ID: "two", HostName: "two.example.com", VIPAddr: "billing"}
+	)
+
+	BeforeEach(func() {
+		registry = newMockRegistry()
+	})
+
+	AfterEach(func() {
+		watcher.Stop()
+	})
+
+	It("restricts events to the given apps", func() {
+		registry.Register(&App{Name: "ORDERS", Instances: []*Instance{matching}})
+		registry.Register(&App{Name: "BILLING", Instances: []*Instance{other}})
+
+		watcher = NewWatcher(registry, interval, WatchApps("orders", "shipping"))
+
+		Eventually(watcher.Events()).Should(Receive(Equal(Event{EventInstanceRegistered, matching, nil})))
+		Consistently(watcher.Events()).ShouldNot(Receive())
+	})
+
+	It("restricts events to the given VIP addresses", func() {
+		registry.Register(&App{Name: "ORDERS", Instances: []*Instance{matching, other}})
+
+		watcher = NewWatcher(registry, interval, WatchVIPs("orders-v2"))
+
+		Eventually(watcher.Events()).Should(Receive(Equal(Event{EventInstanceRegistered, matching, nil})))
+		Consistently(watcher.Events()).ShouldNot(Receive())
+	})
+
+	It("restricts events to instances satisfying all predicates", func() {
+		registry.Register(&App{Name: "ORDERS", Instances: []*Instance{matching, other}})
+
+		watcher = NewWatcher(registry, interval,
+			WatchFilter(func(i *Instance) bool { return i.ID == "one" }),
+			WatchFilter(func(i *Instance) bool { return i.HostName != "" }),
+		)
+
+		Eventually(watcher.Events()).Should(Receive(Equal(Event{EventInstanceRegistered, matching, nil})))
+		Consistently(watcher.Events()).ShouldNot(Receive())
+	})
+
+	It("reports instances leaving the filter as deregistered", func() {
+		registry.Register(&App{Name: "ORDERS", Instances: []*Instance{matching}})
+
+		watcher = NewWatcher(registry, interval, WatchVIPs("orders"))
+		Eventually(watcher.Events()).Should(Receive())
+
+		moved := &Instance{ID: "one", HostName: "one.example.com", VIPAddr: "billing"}
+		registry.Register(&App{Name: "ORDERS", Instances: []*Instance{moved}})
+
+		Eventually(watcher.Events()).Should(Receive(Equal(Event{EventInstanceDeregistered, matching, nil})))
+	})
+
+	Context("when watching a single app", func() {
+		It("polls only that app", func() {
+			registry.Register(&App{Name: "ORDERS", Instances: []*Instance{matching}})
+			registry.Register(&App{Name: "BILLING", Instances: []*Instance{other}})
+
+			watcher = NewWatcher(registry, interval, WatchApps("ORDERS"))
+
+			Eventually(watcher.Events()).Should(Receive(Equal(Event{EventInstanceRegistered, matching, nil})))
+			Expect(registry.AppCalls()).To(BeNumerically(">", 0))
+			Expect(registry.AppsCalls()).To(Equal(0))
+		})
+
+		It("reports all instances as deregistered once the app is gone", func() {
+			registry.Register(&App{Name: "ORDERS", Instances: []*Instance{matching}})
+
+			watcher = NewWatcher(registry, interval, WatchApps("ORDERS"))
+			Eventually(watcher.Events()).Should(Receive())
+
+			registry.Deregister("ORDERS")
+
+			Eventually(watcher.Events()).Should(Receive(Equal(Event{EventInstanceDeregistered, matching, nil})))
+		})
+	})
+})
+
 type mockRegistry struct {
-	mtx  sync.RWMutex
-	apps map[string]*App
+	mtx       sync.RWMutex
+	apps      map[string]*App
+	err       error
+	appCalls  int
+	appsCalls int
 }
 
 func newMockRegistry() *mockRegistry {
@@ -139,7 +874,10 @@ func (m *mockRegistry) Register(app *App) {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 
-	m.apps[app.Name] = app
+	// keep a copy, tests keep modifying the app they have registered
+	c := *app
+	c.Instances = append([]*Instance(nil), app.Instances...)
+	m.apps[app.Name] = &c
 }
 
 func (m *mockRegistry) Deregister(name string) {
@@ -149,9 +887,23 @@ func (m *mockRegistry) Deregister(name string) {
 	delete(m.apps, name)
 }
 
+// Fail makes subsequent requests fail with the given error, nil recovers.
+func (m *mockRegistry) Fail(err error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.err = err
+}
+
 func (m *mockRegistry) Apps() ([]*App, error) {
-	m.mtx.RLock()
-	defer m.mtx.RUnlock()
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.appsCalls++
+
+	if m.err != nil {
+		return nil, m.err
+	}
 
 	apps := make([]*App, 0, len(m.apps))
 	for _, a := range m.apps {
@@ -160,3 +912,93 @@ func (m *mockRegistry) Apps() ([]*App, error) {
 
 	return apps, nil
 }
+
+func (m *mockRegistry) App(name string) (*App, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.appCalls++
+
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	app, found := m.apps[name]
+	if !found {
+		return nil, &ResponseError{StatusCode: 404}
+	}
+
+	return app, nil
+}
+
+func (m *mockRegistry) AppCalls() int {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	return m.appCalls
+}
+
+func (m *mockRegistry) AppsCalls() int {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	return m.appsCalls
+}
+
+// mockDeltaRegistry reports the configured delta, an empty delta by default.
+type mockDeltaRegistry struct {
+	*mockRegistry
+	delta      *AppsResponse
+	deltaErr   error
+	deltaCalls int
+}
+
+// FailDelta makes subsequent deltas fail with the given error, nil recovers.
+func (m *mockDeltaRegistry) FailDelta(err error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.deltaErr = err
+}
+
+func (m *mockDeltaRegistry) SetDelta(delta *AppsResponse) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.delta = delta
+}
+
+func (m *mockDeltaRegistry) Delta() (*AppsResponse, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.deltaCalls++
+
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	if m.deltaErr != nil {
+		return nil, m.deltaErr
+	}
+
+	if m.delta == nil {
+		return &AppsResponse{Hashcode: hashcodeOf(m.apps)}, nil
+	}
+
+	return m.delta, nil
+}
+
+func (m *mockDeltaRegistry) DeltaCalls() int {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	return m.deltaCalls
+}
+
+func hashcodeOf(apps map[string]*App) string {
+	instances := make(map[string]watched)
+	for _, a := range apps {
+		for _, i := range a.Instances {
+			instances[key(a.Name, i)] = watched{a.Name, i}
+		}
+	}
+	return hashcode(instances)
+}